@@ -0,0 +1,335 @@
+package waldo
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type AndroidMetadata struct {
+	abis        []string
+	debuggable  bool
+	minSDK      int
+	packageName string
+	targetSDK   int
+	versionCode int
+	versionName string
+}
+
+type androidResources struct {
+	load   func() (*arscTable, error)
+	loaded bool
+	table  *arscTable
+}
+
+const (
+	androidAttrDebuggable       = 0x0101000f
+	androidAttrMinSDKVersion    = 0x0101020c
+	androidAttrTargetSDKVersion = 0x01010270
+	androidAttrVersionCode      = 0x0101021b
+	androidAttrVersionName      = 0x0101021c
+)
+
+//-----------------------------------------------------------------------------
+
+// Reads the package name, version, SDK levels and debuggable flag from the
+// binary `AndroidManifest.xml` of an APK (resolving resource references
+// against its `resources.arsc`), and the native ABIs from its `lib/` folder.
+//
+// An Android App Bundle (`.aab`) is read from its base module instead, and a
+// split APK set (`.apks`) from its universal APK or base master split.
+func ReadAndroidMetadata(buildPath string) (*AndroidMetadata, error) {
+	file, zr, err := openZip(buildPath)
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open build at ‘%s’, error: %v", buildPath, err)
+	}
+
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(buildPath)) {
+	case ".aab":
+		return readAppBundleMetadata(zr)
+
+	case ".apks":
+		return readAPKSetMetadata(file, zr)
+
+	default:
+		return readAndroidMetadata(zr)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// Returns the native ABIs (such as `arm64-v8a` or `x86_64`) the APK has code
+// for, or nil if it has none (in which case it runs on any ABI).
+func (am *AndroidMetadata) ABIs() []string {
+	if am == nil {
+		return nil
+	}
+
+	return am.abis
+}
+
+func (am *AndroidMetadata) IsDebuggable() bool {
+	return am != nil && am.debuggable
+}
+
+func (am *AndroidMetadata) MinSDKVersion() int {
+	if am == nil {
+		return 0
+	}
+
+	return am.minSDK
+}
+
+func (am *AndroidMetadata) PackageName() string {
+	if am == nil {
+		return ""
+	}
+
+	return am.packageName
+}
+
+func (am *AndroidMetadata) TargetSDKVersion() int {
+	if am == nil {
+		return 0
+	}
+
+	return am.targetSDK
+}
+
+func (am *AndroidMetadata) VersionCode() int {
+	if am == nil {
+		return 0
+	}
+
+	return am.versionCode
+}
+
+func (am *AndroidMetadata) VersionName() string {
+	if am == nil {
+		return ""
+	}
+
+	return am.versionName
+}
+
+//-----------------------------------------------------------------------------
+
+func (am *AndroidMetadata) check(expectations *BuildExpectations) error {
+	if expectations.Debuggable && !am.debuggable {
+		return newCategorizedError(ErrBuildMismatch, nil, "Build is not debuggable")
+	}
+
+	if len(expectations.PackageName) > 0 && am.packageName != expectations.PackageName {
+		return newCategorizedError(ErrBuildMismatch, nil, "Build package name is ‘%s’, expected ‘%s’", am.packageName, expectations.PackageName)
+	}
+
+	if len(am.abis) == 0 {
+		return nil // no native code
+	}
+
+	for _, abi := range expectations.ABIs {
+		if !containsString(am.abis, abi) {
+			return newCategorizedError(ErrBuildMismatch, nil, "Build has no native code for %s (only %s)", abi, strings.Join(am.abis, ", "))
+		}
+	}
+
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+func (ar *androidResources) boolValue(attr *axmlAttribute) bool {
+	value, ok := ar.resolve(attr)
+
+	if !ok {
+		return false
+	}
+
+	if value.valueType == resValueString {
+		return value.str == "true"
+	}
+
+	return value.valueType == resValueBoolean && value.data != 0
+}
+
+func (ar *androidResources) intValue(attr *axmlAttribute) int {
+	value, ok := ar.resolve(attr)
+
+	if !ok {
+		return 0
+	}
+
+	switch value.valueType {
+	case resValueIntDec, resValueIntHex:
+		return int(int32(value.data))
+
+	case resValueString:
+		number, _ := strconv.Atoi(value.str)
+
+		return number
+
+	default:
+		return 0
+	}
+}
+
+func (ar *androidResources) resolve(attr *axmlAttribute) (resValue, bool) {
+	if attr == nil {
+		return resValue{}, false
+	}
+
+	if attr.value.valueType != resValueReference {
+		return attr.value, true
+	}
+
+	//
+	// Only load the resource table (which can be large) when the manifest
+	// refers to it:
+	//
+	if !ar.loaded {
+		ar.loaded = true
+
+		ar.table, _ = ar.load()
+	}
+
+	return ar.table.resolve(attr.value)
+}
+
+func (ar *androidResources) stringValue(attr *axmlAttribute) string {
+	value, ok := ar.resolve(attr)
+
+	if !ok {
+		return ""
+	}
+
+	switch value.valueType {
+	case resValueString:
+		return value.str
+
+	case resValueIntDec:
+		return strconv.Itoa(int(int32(value.data)))
+
+	default:
+		return ""
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func findAndroidABIs(zr *zip.Reader, libPath string) []string {
+	abis := make(map[string]bool)
+
+	for _, file := range zr.File {
+		parts := strings.Split(strings.TrimPrefix(file.Name, libPath+"/"), "/")
+
+		if strings.HasPrefix(file.Name, libPath+"/") && len(parts) == 2 && strings.HasSuffix(parts[1], ".so") {
+			abis[parts[0]] = true
+		}
+	}
+
+	return sortedKeys(abis)
+}
+
+func newAndroidMetadata(elements []axmlElement, resources *androidResources, abis []string) *AndroidMetadata {
+	am := &AndroidMetadata{abis: abis}
+
+	for _, element := range elements {
+		switch element.name {
+		case "application":
+			am.debuggable = resources.boolValue(element.attribute(androidAttrDebuggable, "debuggable"))
+
+		case "manifest":
+			am.packageName = resources.stringValue(element.attribute(0, "package"))
+			am.versionCode = resources.intValue(element.attribute(androidAttrVersionCode, "versionCode"))
+			am.versionName = resources.stringValue(element.attribute(androidAttrVersionName, "versionName"))
+
+		case "uses-sdk":
+			am.minSDK = resources.intValue(element.attribute(androidAttrMinSDKVersion, "minSdkVersion"))
+			am.targetSDK = resources.intValue(element.attribute(androidAttrTargetSDKVersion, "targetSdkVersion"))
+		}
+	}
+
+	if am.targetSDK == 0 {
+		am.targetSDK = am.minSDK // as Android itself assumes
+	}
+
+	return am
+}
+
+func openZip(path string) (*os.File, *zip.Reader, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fi, err := file.Stat()
+
+	if err == nil {
+		var zr *zip.Reader
+
+		if zr, err = zip.NewReader(file, fi.Size()); err == nil {
+			return file, zr, nil
+		}
+	}
+
+	file.Close()
+
+	return nil, nil, err
+}
+
+func readAndroidMetadata(zr *zip.Reader) (*AndroidMetadata, error) {
+	manifest, err := readZipEntry(zr, "AndroidManifest.xml")
+
+	if err != nil {
+		return nil, err
+	}
+
+	elements, err := parseAXML(manifest)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resources := &androidResources{
+		load: func() (*arscTable, error) {
+			data, err := readZipEntry(zr, "resources.arsc")
+
+			if err != nil {
+				return nil, err
+			}
+
+			return parseARSC(data)
+		}}
+
+	return newAndroidMetadata(elements, resources, findAndroidABIs(zr, "lib")), nil
+}
+
+func readZipEntry(zr *zip.Reader, name string) ([]byte, error) {
+	file, err := zr.Open(name)
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read ‘%s’ from archive, error: %v", name, err)
+	}
+
+	defer file.Close()
+
+	return io.ReadAll(file)
+}
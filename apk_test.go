@@ -0,0 +1,342 @@
+package waldo
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+type axmlFixtureAttr struct {
+	data      uint32
+	name      string
+	resID     uint32
+	str       string
+	valueType uint8
+}
+
+type axmlFixtureElement struct {
+	attrs []axmlFixtureAttr
+	name  string
+}
+
+func apkFixture(t *testing.T, manifest []byte, resources []byte, extra ...string) string {
+	apkPath := filepath.Join(t.TempDir(), "app.apk")
+
+	file, err := os.Create(apkPath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	writer := zip.NewWriter(file)
+
+	entries := map[string][]byte{"AndroidManifest.xml": manifest, "classes.dex": []byte("dex")}
+
+	if resources != nil {
+		entries["resources.arsc"] = resources
+	}
+
+	for _, name := range extra {
+		entries[name] = []byte("so")
+	}
+
+	for name, data := range entries {
+		entry, _ := writer.Create(name)
+
+		entry.Write(data)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return apkPath
+}
+
+func arscFixture(resID uint32, value string) []byte {
+	var typeChunk bytes.Buffer
+
+	config := make([]byte, 64)
+
+	binary.LittleEndian.PutUint32(config, 64)
+
+	writeLE(&typeChunk, uint16(resTableTypeType), uint16(20+len(config)), uint32(20+len(config)+4+16))
+	writeLE(&typeChunk, uint8(resID>>16), uint8(0), uint16(0), uint32(resID&0xffff+1), uint32(20+len(config)+4*int(resID&0xffff+1)))
+	typeChunk.Write(config)
+
+	for idx := uint32(0); idx < resID&0xffff; idx++ {
+		writeLE(&typeChunk, uint32(0xffffffff))
+	}
+
+	writeLE(&typeChunk, uint32(0))
+	writeLE(&typeChunk, uint16(8), uint16(0), uint32(0))                       // entry
+	writeLE(&typeChunk, uint16(8), uint8(0), uint8(resValueString), uint32(0)) // value
+
+	fixSize(typeChunk.Bytes())
+
+	var pkg bytes.Buffer
+
+	writeLE(&pkg, uint16(resTablePackageType), uint16(288), uint32(0), resID>>24)
+	pkg.Write(make([]byte, 256+20))
+	pkg.Write(typeChunk.Bytes())
+
+	fixSize(pkg.Bytes())
+
+	var table bytes.Buffer
+
+	writeLE(&table, uint16(resTableType), uint16(12), uint32(0), uint32(1))
+	table.Write(resStringPoolFixture([]string{value}, true))
+	table.Write(pkg.Bytes())
+
+	fixSize(table.Bytes())
+
+	return table.Bytes()
+}
+
+func axmlFixture(elements []axmlFixtureElement) []byte {
+	var (
+		pool   []string
+		resMap []uint32
+	)
+
+	index := func(value string) uint32 {
+		for idx, existing := range pool {
+			if existing == value {
+				return uint32(idx)
+			}
+		}
+
+		pool = append(pool, value)
+
+		return uint32(len(pool) - 1)
+	}
+
+	//
+	// Attribute names with resource IDs come first, so that the resource map
+	// lines up with them:
+	//
+	for _, element := range elements {
+		for _, attr := range element.attrs {
+			if attr.resID != 0 {
+				index(attr.name)
+
+				resMap = append(resMap, attr.resID)
+			}
+		}
+	}
+
+	var body bytes.Buffer
+
+	for _, element := range elements {
+		var chunk bytes.Buffer
+
+		writeLE(&chunk, uint16(resXMLStartElementType), uint16(16), uint32(0), uint32(1), uint32(0xffffffff))
+		writeLE(&chunk, uint32(0xffffffff), index(element.name), uint16(20), uint16(20), uint16(len(element.attrs)), uint16(0), uint16(0), uint16(0))
+
+		for _, attr := range element.attrs {
+			rawValue := uint32(0xffffffff)
+			data := attr.data
+
+			if len(attr.str) > 0 {
+				rawValue = index(attr.str)
+				data = rawValue
+			}
+
+			writeLE(&chunk, uint32(0xffffffff), index(attr.name), rawValue, uint16(8), uint8(0), attr.valueType, data)
+		}
+
+		fixSize(chunk.Bytes())
+
+		body.Write(chunk.Bytes())
+	}
+
+	var resMapChunk bytes.Buffer
+
+	writeLE(&resMapChunk, uint16(resXMLResourceMapType), uint16(8), uint32(8+4*len(resMap)))
+
+	for _, resID := range resMap {
+		writeLE(&resMapChunk, resID)
+	}
+
+	var xml bytes.Buffer
+
+	writeLE(&xml, uint16(resXMLType), uint16(8), uint32(0))
+	xml.Write(resStringPoolFixture(pool, false))
+	xml.Write(resMapChunk.Bytes())
+	xml.Write(body.Bytes())
+
+	fixSize(xml.Bytes())
+
+	return xml.Bytes()
+}
+
+func fixSize(chunk []byte) {
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(len(chunk)))
+}
+
+func manifestFixture(versionName axmlFixtureAttr, debuggable bool) []byte {
+	return axmlFixture([]axmlFixtureElement{
+		{
+			name: "manifest",
+			attrs: []axmlFixtureAttr{
+				{name: "versionCode", resID: androidAttrVersionCode, valueType: resValueIntDec, data: 42},
+				versionName,
+				{name: "package", str: "com.example.app", valueType: resValueString}}},
+		{
+			name: "uses-sdk",
+			attrs: []axmlFixtureAttr{
+				{name: "minSdkVersion", resID: androidAttrMinSDKVersion, valueType: resValueIntDec, data: 24},
+				{name: "targetSdkVersion", resID: androidAttrTargetSDKVersion, valueType: resValueIntDec, data: 34}}},
+		{
+			name: "application",
+			attrs: []axmlFixtureAttr{
+				{name: "debuggable", resID: androidAttrDebuggable, valueType: resValueBoolean, data: map[bool]uint32{false: 0, true: 0xffffffff}[debuggable]}}}})
+}
+
+func resStringPoolFixture(values []string, utf8 bool) []byte {
+	var data bytes.Buffer
+
+	offsets := make([]uint32, len(values))
+
+	for idx, value := range values {
+		offsets[idx] = uint32(data.Len())
+
+		if utf8 {
+			writeLE(&data, uint8(len([]rune(value))), uint8(len(value)))
+			data.WriteString(value)
+			data.WriteByte(0)
+		} else {
+			chars := utf16.Encode([]rune(value))
+
+			writeLE(&data, uint16(len(chars)), chars, uint16(0))
+		}
+	}
+
+	for data.Len()%4 != 0 {
+		data.WriteByte(0)
+	}
+
+	flags := uint32(0)
+
+	if utf8 {
+		flags = 0x100
+	}
+
+	var chunk bytes.Buffer
+
+	writeLE(&chunk, uint16(resStringPoolType), uint16(28), uint32(0), uint32(len(values)), uint32(0), flags, uint32(28+4*len(values)), uint32(0))
+	writeLE(&chunk, offsets)
+	chunk.Write(data.Bytes())
+
+	fixSize(chunk.Bytes())
+
+	return chunk.Bytes()
+}
+
+func writeLE(buffer *bytes.Buffer, values ...interface{}) {
+	for _, value := range values {
+		binary.Write(buffer, binary.LittleEndian, value)
+	}
+}
+
+func TestParseARSCMalformed(t *testing.T) {
+	table := arscFixture(0x7f020003, "2.0-beta")
+
+	typeChunk := bytes.Index(table, []byte{0x01, 0x02, 0x54, 0x00})
+
+	table[typeChunk+9] = 0x03 // sparse, 16-bit offsets
+
+	binary.LittleEndian.PutUint32(table[typeChunk+12:], 16) // fits only 2 bytes per entry
+
+	copy(table[typeChunk+84:], make([]byte, 16)) // entry 0 at offset 0
+
+	if _, err := parseARSC(table); err != errMalformedARSC {
+		t.Errorf("Expected errMalformedARSC, got %v", err)
+	}
+}
+
+func TestReadAndroidMetadata(t *testing.T) {
+	versionName := axmlFixtureAttr{name: "versionName", resID: androidAttrVersionName, str: "1.2.3", valueType: resValueString}
+
+	apkPath := apkFixture(t, manifestFixture(versionName, true), nil, "lib/x86_64/libapp.so", "lib/arm64-v8a/libapp.so")
+
+	metadata, err := ReadAndroidMetadata(apkPath)
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if metadata.PackageName() != "com.example.app" || metadata.VersionName() != "1.2.3" || metadata.VersionCode() != 42 {
+		t.Errorf("Expected package and version, got %+v", metadata)
+	}
+
+	if metadata.MinSDKVersion() != 24 || metadata.TargetSDKVersion() != 34 || !metadata.IsDebuggable() {
+		t.Errorf("Expected SDK levels and debuggable, got %+v", metadata)
+	}
+
+	if abis := metadata.ABIs(); !reflect.DeepEqual(abis, []string{"arm64-v8a", "x86_64"}) {
+		t.Errorf("Expected ABIs, got %v", abis)
+	}
+}
+
+func TestReadAndroidMetadataMalformed(t *testing.T) {
+	if _, err := ReadAndroidMetadata(apkFixture(t, []byte("<manifest/>"), nil)); err == nil {
+		t.Errorf("Expected error, got nil")
+	}
+}
+
+func TestReadAndroidMetadataResourceReference(t *testing.T) {
+	versionName := axmlFixtureAttr{name: "versionName", resID: androidAttrVersionName, valueType: resValueReference, data: 0x7f020003}
+
+	apkPath := apkFixture(t, manifestFixture(versionName, false), arscFixture(0x7f020003, "2.0-beta"))
+
+	metadata, err := ReadAndroidMetadata(apkPath)
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if metadata.VersionName() != "2.0-beta" || metadata.IsDebuggable() {
+		t.Errorf("Expected resolved version name, got %+v", metadata)
+	}
+}
+
+func TestUploaderBuildExpectations(t *testing.T) {
+	versionName := axmlFixtureAttr{name: "versionName", resID: androidAttrVersionName, str: "1.2.3", valueType: resValueString}
+
+	apkPath := apkFixture(t, manifestFixture(versionName, false), nil, "lib/armeabi-v7a/libapp.so")
+
+	for _, expectations := range []BuildExpectations{
+		{ABIs: []string{"x86_64"}},
+		{Debuggable: true},
+		{PackageName: "com.example.other"}} {
+		err := NewUploaderWithOptions(apkPath, secretUploadToken,
+			WithBuildExpectations(expectations),
+			WithCommandRunner(&fakeCommandRunner{})).Validate()
+
+		if !errors.Is(err, ErrBuildMismatch) {
+			t.Errorf("Expected ErrBuildMismatch for %+v, got %v", expectations, err)
+		}
+	}
+
+	uploader := NewUploaderWithOptions(apkPath, secretUploadToken,
+		WithBuildExpectations(BuildExpectations{ABIs: []string{"armeabi-v7a"}, PackageName: "com.example.app"}),
+		WithCommandRunner(&fakeCommandRunner{}))
+
+	if err := uploader.Validate(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if url := uploader.makeBuildURL(); !strings.Contains(url, "appID=com.example.app") || !strings.Contains(url, "appVersionCode=42") {
+		t.Errorf("Expected metadata in build URL, got %s", url)
+	}
+}
@@ -0,0 +1,464 @@
+package waldo
+
+import (
+	"encoding/binary"
+	"errors"
+	"unicode/utf16"
+)
+
+type arscTable struct {
+	values map[uint32]resValue
+}
+
+type axmlAttribute struct {
+	name  string
+	resID uint32 // zero if not an `android:` attribute
+	value resValue
+}
+
+type axmlElement struct {
+	attributes []axmlAttribute
+	name       string
+}
+
+type resValue struct {
+	data      uint32
+	str       string // resolved for resValueString only
+	valueType uint8
+}
+
+const (
+	resStringPoolType      = 0x0001
+	resTableType           = 0x0002
+	resXMLType             = 0x0003
+	resXMLStartElementType = 0x0102
+	resXMLResourceMapType  = 0x0180
+	resTablePackageType    = 0x0200
+	resTableTypeType       = 0x0201
+)
+
+const (
+	resValueReference = 0x01
+	resValueString    = 0x03
+	resValueIntDec    = 0x10
+	resValueIntHex    = 0x11
+	resValueBoolean   = 0x12
+)
+
+var (
+	errMalformedARSC = errors.New("Malformed resource table")
+	errMalformedAXML = errors.New("Malformed binary XML")
+)
+
+//-----------------------------------------------------------------------------
+
+// Decodes the start elements of a compiled (binary) Android XML file, such as
+// the `AndroidManifest.xml` of an APK. Everything else (end elements,
+// namespaces, text) is irrelevant to the metadata we need and is skipped.
+func parseAXML(data []byte) ([]axmlElement, error) {
+	if len(data) < 8 || binary.LittleEndian.Uint16(data) != resXMLType {
+		return nil, errMalformedAXML
+	}
+
+	var (
+		elements []axmlElement
+		pool     []string
+		resMap   []uint32
+	)
+
+	err := forEachResChunk(data, errMalformedAXML, func(chunkType uint16, chunk []byte) error {
+		var err error
+
+		switch chunkType {
+		case resStringPoolType:
+			pool, err = parseResStringPool(chunk)
+
+		case resXMLResourceMapType:
+			headerSize := int(binary.LittleEndian.Uint16(chunk[2:]))
+
+			for offset := headerSize; offset+4 <= len(chunk); offset += 4 {
+				resMap = append(resMap, binary.LittleEndian.Uint32(chunk[offset:]))
+			}
+
+		case resXMLStartElementType:
+			var element axmlElement
+
+			if element, err = parseAXMLStartElement(chunk, pool, resMap); err == nil {
+				elements = append(elements, element)
+			}
+		}
+
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return elements, nil
+}
+
+// Decodes the simple values of a compiled resource table (`resources.arsc`).
+// When a resource has several configurations (for example, per locale), the
+// first one found, which is normally the default, wins.
+func parseARSC(data []byte) (*arscTable, error) {
+	if len(data) < 8 || binary.LittleEndian.Uint16(data) != resTableType {
+		return nil, errMalformedARSC
+	}
+
+	table := &arscTable{values: make(map[uint32]resValue)}
+
+	var pool []string
+
+	err := forEachResChunk(data, errMalformedARSC, func(chunkType uint16, chunk []byte) error {
+		var err error
+
+		switch chunkType {
+		case resStringPoolType:
+			pool, err = parseResStringPool(chunk)
+
+		case resTablePackageType:
+			err = table.parsePackage(chunk, pool)
+		}
+
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return table, nil
+}
+
+//-----------------------------------------------------------------------------
+
+func (ae *axmlElement) attribute(resID uint32, name string) *axmlAttribute {
+	for idx := range ae.attributes {
+		attr := &ae.attributes[idx]
+
+		if (resID != 0 && attr.resID == resID) || (attr.resID == 0 && attr.name == name) {
+			return attr
+		}
+	}
+
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+func (at *arscTable) parsePackage(chunk []byte, pool []string) error {
+	if len(chunk) < 12 {
+		return errMalformedARSC
+	}
+
+	packageID := binary.LittleEndian.Uint32(chunk[8:])
+
+	return forEachResChunk(chunk, errMalformedARSC, func(chunkType uint16, subchunk []byte) error {
+		if chunkType != resTableTypeType {
+			return nil
+		}
+
+		return at.parseType(subchunk, packageID, pool)
+	})
+}
+
+func (at *arscTable) parseType(chunk []byte, packageID uint32, pool []string) error {
+	if len(chunk) < 20 {
+		return errMalformedARSC
+	}
+
+	const (
+		flagSparse   = 0x01
+		flagOffset16 = 0x02
+
+		entryFlagComplex = 0x0001
+		entryFlagCompact = 0x0008
+	)
+
+	headerSize := int(binary.LittleEndian.Uint16(chunk[2:]))
+	typeID := uint32(chunk[8])
+	flags := chunk[9]
+	entryCount := int(binary.LittleEndian.Uint32(chunk[12:]))
+	entriesStart := int(binary.LittleEndian.Uint32(chunk[16:]))
+
+	//
+	// Sparse entries are always 4 bytes (index and offset), even with 16-bit
+	// offsets:
+	//
+	offsetSize := 4
+
+	if flags&flagSparse == 0 && flags&flagOffset16 != 0 {
+		offsetSize = 2
+	}
+
+	if headerSize+entryCount*offsetSize > len(chunk) {
+		return errMalformedARSC
+	}
+
+	for idx := 0; idx < entryCount; idx++ {
+		entryIdx := uint32(idx)
+		entryOffset := -1
+
+		switch {
+		case flags&flagSparse != 0:
+			entryIdx = uint32(binary.LittleEndian.Uint16(chunk[headerSize+idx*4:]))
+			entryOffset = int(binary.LittleEndian.Uint16(chunk[headerSize+idx*4+2:])) * 4
+
+		case flags&flagOffset16 != 0:
+			if offset := binary.LittleEndian.Uint16(chunk[headerSize+idx*2:]); offset != 0xffff {
+				entryOffset = int(offset) * 4
+			}
+
+		default:
+			if offset := binary.LittleEndian.Uint32(chunk[headerSize+idx*4:]); offset != 0xffffffff {
+				entryOffset = int(offset)
+			}
+		}
+
+		if entryOffset < 0 {
+			continue
+		}
+
+		resID := packageID<<24 | typeID<<16 | entryIdx
+
+		if _, found := at.values[resID]; found {
+			continue
+		}
+
+		entry := entriesStart + entryOffset
+
+		if entry+8 > len(chunk) {
+			return errMalformedARSC
+		}
+
+		entrySize := int(binary.LittleEndian.Uint16(chunk[entry:]))
+		entryFlags := binary.LittleEndian.Uint16(chunk[entry+2:])
+
+		var value resValue
+
+		switch {
+		case entryFlags&entryFlagCompact != 0:
+			value.valueType = uint8(entryFlags >> 8)
+			value.data = binary.LittleEndian.Uint32(chunk[entry+4:])
+
+		case entryFlags&entryFlagComplex != 0:
+			continue // styles, arrays and the like
+
+		default:
+			if entry+entrySize+8 > len(chunk) {
+				return errMalformedARSC
+			}
+
+			value.valueType = chunk[entry+entrySize+3]
+			value.data = binary.LittleEndian.Uint32(chunk[entry+entrySize+4:])
+		}
+
+		if value.valueType == resValueString {
+			value.str = poolString(pool, value.data)
+		}
+
+		at.values[resID] = value
+	}
+
+	return nil
+}
+
+// Follows references (a few levels at most) until a plain value is reached.
+func (at *arscTable) resolve(value resValue) (resValue, bool) {
+	for depth := 0; value.valueType == resValueReference; depth++ {
+		if at == nil || depth >= 8 {
+			return resValue{}, false
+		}
+
+		resolved, found := at.values[value.data]
+
+		if !found {
+			return resValue{}, false
+		}
+
+		value = resolved
+	}
+
+	return value, true
+}
+
+//-----------------------------------------------------------------------------
+
+func decodeResString(data []byte, utf8 bool) (string, bool) {
+	if utf8 {
+		_, skip := decodeResStringLength8(data) // length in characters
+
+		length, size := decodeResStringLength8(data[skip:])
+
+		start := skip + size
+
+		if size == 0 || start+length > len(data) {
+			return "", false
+		}
+
+		return string(data[start : start+length]), true
+	}
+
+	if len(data) < 2 {
+		return "", false
+	}
+
+	length := int(binary.LittleEndian.Uint16(data))
+	start := 2
+
+	if length&0x8000 != 0 {
+		if len(data) < 4 {
+			return "", false
+		}
+
+		length = (length&0x7fff)<<16 | int(binary.LittleEndian.Uint16(data[2:]))
+		start = 4
+	}
+
+	if start+length*2 > len(data) {
+		return "", false
+	}
+
+	chars := make([]uint16, length)
+
+	for idx := range chars {
+		chars[idx] = binary.LittleEndian.Uint16(data[start+idx*2:])
+	}
+
+	return string(utf16.Decode(chars)), true
+}
+
+func decodeResStringLength8(data []byte) (int, int) {
+	if len(data) < 1 {
+		return 0, 0
+	}
+
+	if data[0]&0x80 == 0 {
+		return int(data[0]), 1
+	}
+
+	if len(data) < 2 {
+		return 0, 0
+	}
+
+	return int(data[0]&0x7f)<<8 | int(data[1]), 2
+}
+
+// Calls `fn` for each chunk nested in `data`, which must itself be a chunk.
+func forEachResChunk(data []byte, malformed error, fn func(chunkType uint16, chunk []byte) error) error {
+	headerSize := int(binary.LittleEndian.Uint16(data[2:]))
+	end := int(binary.LittleEndian.Uint32(data[4:]))
+
+	if end > len(data) {
+		end = len(data)
+	}
+
+	for offset := headerSize; offset+8 <= end; {
+		chunkType := binary.LittleEndian.Uint16(data[offset:])
+		chunkHeaderSize := int(binary.LittleEndian.Uint16(data[offset+2:]))
+		chunkSize := int(binary.LittleEndian.Uint32(data[offset+4:]))
+
+		if chunkHeaderSize < 8 || chunkSize < chunkHeaderSize || offset+chunkSize > end {
+			return malformed
+		}
+
+		if err := fn(chunkType, data[offset:offset+chunkSize]); err != nil {
+			return err
+		}
+
+		offset += chunkSize
+	}
+
+	return nil
+}
+
+func parseAXMLStartElement(chunk []byte, pool []string, resMap []uint32) (axmlElement, error) {
+	headerSize := int(binary.LittleEndian.Uint16(chunk[2:]))
+
+	if headerSize+20 > len(chunk) {
+		return axmlElement{}, errMalformedAXML
+	}
+
+	ext := chunk[headerSize:]
+
+	attrStart := int(binary.LittleEndian.Uint16(ext[8:]))
+	attrSize := int(binary.LittleEndian.Uint16(ext[10:]))
+	attrCount := int(binary.LittleEndian.Uint16(ext[12:]))
+
+	if attrSize < 20 || attrStart+attrCount*attrSize > len(ext) {
+		return axmlElement{}, errMalformedAXML
+	}
+
+	element := axmlElement{name: poolString(pool, binary.LittleEndian.Uint32(ext[4:]))}
+
+	for idx := 0; idx < attrCount; idx++ {
+		raw := ext[attrStart+idx*attrSize:]
+
+		nameIdx := binary.LittleEndian.Uint32(raw[4:])
+		rawValue := binary.LittleEndian.Uint32(raw[8:])
+
+		attr := axmlAttribute{
+			name: poolString(pool, nameIdx),
+			value: resValue{
+				data:      binary.LittleEndian.Uint32(raw[16:]),
+				valueType: raw[15]}}
+
+		if int(nameIdx) < len(resMap) {
+			attr.resID = resMap[nameIdx]
+		}
+
+		if attr.value.valueType == resValueString {
+			attr.value.str = poolString(pool, attr.value.data)
+		} else if rawValue != 0xffffffff {
+			attr.value.str = poolString(pool, rawValue)
+		}
+
+		element.attributes = append(element.attributes, attr)
+	}
+
+	return element, nil
+}
+
+func parseResStringPool(chunk []byte) ([]string, error) {
+	if len(chunk) < 28 {
+		return nil, errMalformedAXML
+	}
+
+	headerSize := int(binary.LittleEndian.Uint16(chunk[2:]))
+	count := int(binary.LittleEndian.Uint32(chunk[8:]))
+	flags := binary.LittleEndian.Uint32(chunk[16:])
+	stringsStart := int(binary.LittleEndian.Uint32(chunk[20:]))
+
+	if headerSize+count*4 > len(chunk) {
+		return nil, errMalformedAXML
+	}
+
+	pool := make([]string, count)
+
+	for idx := range pool {
+		offset := stringsStart + int(binary.LittleEndian.Uint32(chunk[headerSize+idx*4:]))
+
+		if offset >= len(chunk) {
+			return nil, errMalformedAXML
+		}
+
+		value, ok := decodeResString(chunk[offset:], flags&0x100 != 0)
+
+		if !ok {
+			return nil, errMalformedAXML
+		}
+
+		pool[idx] = value
+	}
+
+	return pool, nil
+}
+
+func poolString(pool []string, idx uint32) string {
+	if int(idx) < len(pool) {
+		return pool[idx]
+	}
+
+	return ""
+}
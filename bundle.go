@@ -0,0 +1,288 @@
+package waldo
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	apkSetBaseMaster = "splits/base-master.apk"
+	apkSetUniversal  = "universal.apk"
+
+	appBundleConfig       = "BundleConfig.pb"
+	appBundleBaseManifest = "base/manifest/AndroidManifest.xml"
+)
+
+//-----------------------------------------------------------------------------
+
+// Checks the structure of an Android App Bundle (`.aab`) or split APK set
+// (`.apks`) before anything is uploaded. For an APK set, also returns the name
+// of its universal APK, which is uploaded instead of the whole set, if any.
+func checkAndroidBuildStructure(buildPath, buildSuffix string) (string, error) {
+	if buildSuffix != "aab" && buildSuffix != "apks" {
+		return "", nil
+	}
+
+	file, zr, err := openZip(buildPath)
+
+	if err != nil {
+		return "", newCategorizedError(ErrInvalidBuildPath, err, "Unable to open build at ‘%s’, error: %v", buildPath, err)
+	}
+
+	defer file.Close()
+
+	if buildSuffix == "aab" {
+		err = checkAppBundle(zr)
+	} else {
+		err = checkAPKSet(file, zr)
+	}
+
+	if err != nil {
+		return "", newCategorizedError(ErrInvalidBuildPath, err, "Invalid build at ‘%s’, error: %v", buildPath, err)
+	}
+
+	if findZipEntry(zr, apkSetUniversal) != nil {
+		return apkSetUniversal, nil
+	}
+
+	return "", nil
+}
+
+//-----------------------------------------------------------------------------
+
+func checkAPKSet(file *os.File, zr *zip.Reader) error {
+	if findZipEntry(zr, apkSetUniversal) != nil {
+		_, err := readNestedAndroidMetadata(file, zr, apkSetUniversal)
+
+		return err
+	}
+
+	base, err := readNestedAndroidMetadata(file, zr, apkSetBaseMaster)
+
+	if err != nil {
+		return err
+	}
+
+	//
+	// Every split must belong to the same app as the base:
+	//
+	for _, name := range findAPKSetSplits(zr) {
+		nested, err := openNestedZip(file, zr, name)
+
+		if err != nil {
+			return err
+		}
+
+		manifest, err := readZipEntry(nested, "AndroidManifest.xml")
+
+		if err != nil {
+			return err
+		}
+
+		elements, err := parseAXML(manifest)
+
+		if err != nil {
+			return err
+		}
+
+		for _, element := range elements {
+			if element.name != "manifest" {
+				continue
+			}
+
+			if attr := element.attribute(0, "package"); attr == nil || attr.value.str != base.packageName {
+				return fmt.Errorf("Split ‘%s’ does not belong to package ‘%s’", name, base.packageName)
+			}
+		}
+	}
+
+	return nil
+}
+
+func checkAppBundle(zr *zip.Reader) error {
+	if findZipEntry(zr, appBundleConfig) == nil {
+		return fmt.Errorf("No %s found", appBundleConfig)
+	}
+
+	if findZipEntry(zr, appBundleBaseManifest) == nil {
+		return fmt.Errorf("No base module found")
+	}
+
+	//
+	// Every module (not only the base) must have a readable manifest:
+	//
+	for _, file := range zr.File {
+		parts := strings.Split(file.Name, "/")
+
+		if len(parts) != 3 || parts[1] != "manifest" || parts[2] != "AndroidManifest.xml" {
+			continue
+		}
+
+		manifest, err := readZipEntry(zr, file.Name)
+
+		if err != nil {
+			return err
+		}
+
+		if _, err = parseProtoXML(manifest); err != nil {
+			return fmt.Errorf("Unable to read manifest of module ‘%s’, error: %v", parts[0], err)
+		}
+	}
+
+	return nil
+}
+
+// Extracts an APK from an APK set so that it can be uploaded on its own.
+func extractZipEntry(zipPath, name, destPath string) (int64, error) {
+	reader, err := zip.OpenReader(zipPath)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer reader.Close()
+
+	src, err := reader.Open(name)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer src.Close()
+
+	dst, err := os.Create(destPath)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer dst.Close()
+
+	return io.Copy(dst, src)
+}
+
+func findAPKSetSplits(zr *zip.Reader) []string {
+	var names []string
+
+	for _, file := range zr.File {
+		if path.Dir(file.Name) == "splits" && path.Ext(file.Name) == ".apk" {
+			names = append(names, file.Name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func findZipEntry(zr *zip.Reader, name string) *zip.File {
+	for _, file := range zr.File {
+		if file.Name == name {
+			return file
+		}
+	}
+
+	return nil
+}
+
+// Opens an APK nested in an APK set. APKs are normally stored (rather than
+// deflated) in the set, in which case they are read in place.
+func openNestedZip(file *os.File, zr *zip.Reader, name string) (*zip.Reader, error) {
+	entry := findZipEntry(zr, name)
+
+	if entry == nil {
+		return nil, fmt.Errorf("No %s found", name)
+	}
+
+	if entry.Method == zip.Store {
+		if offset, err := entry.DataOffset(); err == nil {
+			size := int64(entry.UncompressedSize64)
+
+			return zip.NewReader(io.NewSectionReader(file, offset, size), size)
+		}
+	}
+
+	data, err := readZipEntry(zr, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return zip.NewReader(bytes.NewReader(data), int64(len(data)))
+}
+
+func readAPKSetMetadata(file *os.File, zr *zip.Reader) (*AndroidMetadata, error) {
+	if findZipEntry(zr, apkSetUniversal) != nil {
+		return readNestedAndroidMetadata(file, zr, apkSetUniversal)
+	}
+
+	am, err := readNestedAndroidMetadata(file, zr, apkSetBaseMaster)
+
+	if err != nil {
+		return nil, err
+	}
+
+	//
+	// Native code lives in the ABI splits rather than in the base:
+	//
+	abis := make(map[string]bool)
+
+	for _, abi := range am.abis {
+		abis[abi] = true
+	}
+
+	for _, name := range findAPKSetSplits(zr) {
+		if nested, err := openNestedZip(file, zr, name); err == nil {
+			for _, abi := range findAndroidABIs(nested, "lib") {
+				abis[abi] = true
+			}
+		}
+	}
+
+	am.abis = sortedKeys(abis)
+
+	return am, nil
+}
+
+func readAppBundleMetadata(zr *zip.Reader) (*AndroidMetadata, error) {
+	manifest, err := readZipEntry(zr, appBundleBaseManifest)
+
+	if err != nil {
+		return nil, err
+	}
+
+	elements, err := parseProtoXML(manifest)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resources := &androidResources{
+		load: func() (*arscTable, error) {
+			data, err := readZipEntry(zr, "base/resources.pb")
+
+			if err != nil {
+				return nil, err
+			}
+
+			return parseProtoResourceTable(data)
+		}}
+
+	return newAndroidMetadata(elements, resources, findAndroidABIs(zr, "base/lib")), nil
+}
+
+func readNestedAndroidMetadata(file *os.File, zr *zip.Reader, name string) (*AndroidMetadata, error) {
+	nested, err := openNestedZip(file, zr, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return readAndroidMetadata(nested)
+}
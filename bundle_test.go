@@ -0,0 +1,225 @@
+package waldo
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func appBundleFixture(t *testing.T, withConfig bool) string {
+	intItem := func(value uint64) []byte {
+		return protoBytes(7, protoVarint(6, value)) // prim.int_decimal_value
+	}
+
+	attr := func(name string, resID uint32, raw string, item []byte) []byte {
+		return protoBytes(4, bytes.Join([][]byte{
+			protoBytes(2, []byte(name)),
+			protoBytes(3, []byte(raw)),
+			protoVarint(5, uint64(resID)),
+			protoBytes(6, item)}, nil))
+	}
+
+	element := func(name string, content ...[]byte) []byte {
+		return protoBytes(1, append(protoBytes(3, []byte(name)), bytes.Join(content, nil)...))
+	}
+
+	manifest := element("manifest",
+		attr("package", 0, "com.example.app", nil),
+		attr("versionCode", androidAttrVersionCode, "42", intItem(42)),
+		attr("versionName", androidAttrVersionName, "@string/version_name", protoBytes(1, protoVarint(2, 0x7f020003))),
+		protoBytes(5, element("uses-sdk",
+			attr("minSdkVersion", androidAttrMinSDKVersion, "24", intItem(24)))),
+		protoBytes(5, element("application",
+			attr("debuggable", androidAttrDebuggable, "true", protoBytes(7, protoVarint(8, 1))))))
+
+	resources := protoBytes(2, bytes.Join([][]byte{
+		protoBytes(1, protoVarint(1, 0x7f)),
+		protoBytes(3, bytes.Join([][]byte{
+			protoBytes(1, protoVarint(1, 0x02)),
+			protoBytes(3, bytes.Join([][]byte{
+				protoBytes(1, protoVarint(1, 0x0003)),
+				protoBytes(6, protoBytes(2, protoBytes(4, protoBytes(2, protoBytes(1, []byte("3.0"))))))}, nil))}, nil))}, nil))
+
+	entries := map[string][]byte{
+		"base/dex/classes.dex":              []byte("dex"),
+		"base/lib/x86_64/libapp.so":         []byte("so"),
+		"base/manifest/AndroidManifest.xml": manifest,
+		"base/resources.pb":                 resources}
+
+	if withConfig {
+		entries["BundleConfig.pb"] = protoBytes(1, protoBytes(1, []byte("1.15.6"))) // bundletool.version
+	}
+
+	return writeZipFixture(t, "app.aab", entries)
+}
+
+func apkSetFixture(t *testing.T, splitPackage string, universal bool) string {
+	versionName := axmlFixtureAttr{name: "versionName", resID: androidAttrVersionName, str: "1.2.3", valueType: resValueString}
+
+	split := axmlFixture([]axmlFixtureElement{
+		{
+			name: "manifest",
+			attrs: []axmlFixtureAttr{
+				{name: "package", str: splitPackage, valueType: resValueString},
+				{name: "split", str: "config.x86_64", valueType: resValueString}}}})
+
+	if universal {
+		return writeZipFixture(t, "app.apks", map[string][]byte{
+			"toc.pb":        nil,
+			"universal.apk": zipFixture(map[string][]byte{"AndroidManifest.xml": manifestFixture(versionName, false)})})
+	}
+
+	return writeZipFixture(t, "app.apks", map[string][]byte{
+		"splits/base-master.apk": zipFixture(map[string][]byte{"AndroidManifest.xml": manifestFixture(versionName, false)}),
+		"splits/base-x86_64.apk": zipFixture(map[string][]byte{"AndroidManifest.xml": split, "lib/x86_64/libapp.so": []byte("so")}),
+		"toc.pb":                 nil})
+}
+
+func protoBytes(number int, data []byte) []byte {
+	header := append(uvarint(uint64(number<<3|protoWireBytes)), uvarint(uint64(len(data)))...)
+
+	return append(header, data...)
+}
+
+func protoVarint(number int, value uint64) []byte {
+	return append(uvarint(uint64(number<<3|protoWireVarint)), uvarint(value)...)
+}
+
+func uvarint(value uint64) []byte {
+	buffer := make([]byte, binary.MaxVarintLen64)
+
+	return buffer[:binary.PutUvarint(buffer, value)]
+}
+
+// Nested APKs are stored rather than deflated, as bundletool does.
+func zipFixture(entries map[string][]byte) []byte {
+	var buffer bytes.Buffer
+
+	writer := zip.NewWriter(&buffer)
+
+	for name, data := range entries {
+		entry, _ := writer.CreateHeader(&zip.FileHeader{Method: zip.Store, Name: name})
+
+		entry.Write(data)
+	}
+
+	writer.Close()
+
+	return buffer.Bytes()
+}
+
+func writeZipFixture(t *testing.T, name string, entries map[string][]byte) string {
+	path := filepath.Join(t.TempDir(), name)
+
+	if err := os.WriteFile(path, zipFixture(entries), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestParseProtoXMLMalformed(t *testing.T) {
+	for _, data := range [][]byte{nil, {0x0a, 0x05, 0x1a}, {0x0f}} {
+		if _, err := parseProtoXML(data); err == nil {
+			t.Errorf("Expected error for %v, got nil", data)
+		}
+	}
+}
+
+func TestReadAndroidMetadataAPKSet(t *testing.T) {
+	metadata, err := ReadAndroidMetadata(apkSetFixture(t, "com.example.app", false))
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if metadata.PackageName() != "com.example.app" || metadata.VersionName() != "1.2.3" || metadata.VersionCode() != 42 {
+		t.Errorf("Expected package and version, got %+v", metadata)
+	}
+
+	if abis := metadata.ABIs(); !reflect.DeepEqual(abis, []string{"x86_64"}) {
+		t.Errorf("Expected ABIs from splits, got %v", abis)
+	}
+}
+
+func TestReadAndroidMetadataAppBundle(t *testing.T) {
+	metadata, err := ReadAndroidMetadata(appBundleFixture(t, true))
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if metadata.PackageName() != "com.example.app" || metadata.VersionName() != "3.0" || metadata.VersionCode() != 42 {
+		t.Errorf("Expected package and resolved version, got %+v", metadata)
+	}
+
+	if metadata.MinSDKVersion() != 24 || metadata.TargetSDKVersion() != 24 || !metadata.IsDebuggable() {
+		t.Errorf("Expected SDK levels and debuggable, got %+v", metadata)
+	}
+
+	if abis := metadata.ABIs(); !reflect.DeepEqual(abis, []string{"x86_64"}) {
+		t.Errorf("Expected ABIs, got %v", abis)
+	}
+}
+
+func TestUploaderAPKSetInvalid(t *testing.T) {
+	err := NewUploaderWithOptions(apkSetFixture(t, "com.example.other", false), secretUploadToken,
+		WithCommandRunner(&fakeCommandRunner{})).Validate()
+
+	if !errors.Is(err, ErrInvalidBuildPath) || !strings.Contains(err.Error(), "base-x86_64.apk") {
+		t.Errorf("Expected ErrInvalidBuildPath for foreign split, got %v", err)
+	}
+}
+
+func TestUploaderAPKSetUniversal(t *testing.T) {
+	uploader := NewUploaderWithOptions(apkSetFixture(t, "", true), secretUploadToken,
+		WithCommandRunner(&fakeCommandRunner{}),
+		WithDryRun(true))
+
+	err := uploader.Validate()
+
+	if err == nil {
+		err = uploader.Upload()
+	}
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if uploader.buildEntry != "universal.apk" || filepath.Base(uploader.BuildPayloadPath()) != "app.apk" {
+		t.Errorf("Expected universal APK payload, got %s", uploader.BuildPayloadPath())
+	}
+
+	request := uploader.DryRunRequest()
+
+	if request == nil || request.Header.Get("Content-Type") != "application/octet-stream" || request.Size == 0 {
+		t.Errorf("Expected dry-run request for APK, got %+v", request)
+	}
+}
+
+func TestUploaderAppBundle(t *testing.T) {
+	err := NewUploaderWithOptions(appBundleFixture(t, false), secretUploadToken,
+		WithCommandRunner(&fakeCommandRunner{})).Validate()
+
+	if !errors.Is(err, ErrInvalidBuildPath) || !strings.Contains(err.Error(), "BundleConfig.pb") {
+		t.Errorf("Expected ErrInvalidBuildPath for missing bundle config, got %v", err)
+	}
+
+	uploader := NewUploaderWithOptions(appBundleFixture(t, true), secretUploadToken,
+		WithBuildExpectations(BuildExpectations{ABIs: []string{"x86_64"}, PackageName: "com.example.app"}),
+		WithCommandRunner(&fakeCommandRunner{}))
+
+	if err := uploader.Validate(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if uploader.BuildPayloadPath() != uploader.BuildPath() || uploader.buildContentType() != "application/octet-stream" {
+		t.Errorf("Expected bundle to be uploaded as is, got %s", uploader.BuildPayloadPath())
+	}
+}
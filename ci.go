@@ -2,14 +2,21 @@ package waldo
 
 import (
 	"os"
+	"strconv"
 	"strings"
 )
 
 type CIInfo struct {
-	gitBranch string
-	gitCommit string
-	provider  CIProvider
-	skipCount int
+	baseBranch   string // target branch of a pull request
+	buildURL     string
+	custom       *customCIConfig
+	env          Environment
+	gitBranch    string
+	gitCommit    string
+	prNumber     int
+	provider     CIProvider
+	providerName string
+	skipCount    int
 }
 
 //-----------------------------------------------------------------------------
@@ -28,6 +35,7 @@ const (
 	TeamCity
 	TravisCI
 	XcodeCloud
+	Custom // new providers MUST be appended to keep existing values stable
 )
 
 func (cp CIProvider) String() string {
@@ -42,13 +50,30 @@ func (cp CIProvider) String() string {
 		"Jenkins",
 		"TeamCity",
 		"Travis CI",
-		"Xcode Cloud"}[cp]
+		"Xcode Cloud",
+		"Custom"}[cp]
 }
 
 //-----------------------------------------------------------------------------
 
 func DetectCIInfo(fullInfo bool) *CIInfo {
-	info := &CIInfo{provider: detectCIProvider()}
+	return DetectCIInfoWithOptions(fullInfo, InferOptions{})
+}
+
+func DetectCIInfoWithOptions(fullInfo bool, options InferOptions) *CIInfo {
+	env := options.environment()
+	custom := detectCustomCIConfig(options.Overrides, env)
+
+	info := &CIInfo{
+		custom:   custom,
+		env:      env,
+		provider: detectCIProvider(custom, env)}
+
+	if info.provider == Custom {
+		info.providerName = custom.name
+	} else {
+		info.providerName = info.provider.String()
+	}
 
 	if fullInfo {
 		info.extractFullInfo()
@@ -59,6 +84,14 @@ func DetectCIInfo(fullInfo bool) *CIInfo {
 
 //-----------------------------------------------------------------------------
 
+func (ci *CIInfo) BaseBranch() string {
+	return ci.baseBranch
+}
+
+func (ci *CIInfo) BuildURL() string {
+	return ci.buildURL
+}
+
 func (ci *CIInfo) GitBranch() string {
 	return ci.gitBranch
 }
@@ -67,10 +100,18 @@ func (ci *CIInfo) GitCommit() string {
 	return ci.gitCommit
 }
 
+func (ci *CIInfo) PRNumber() int {
+	return ci.prNumber
+}
+
 func (ci *CIInfo) Provider() CIProvider {
 	return ci.provider
 }
 
+func (ci *CIInfo) ProviderName() string {
+	return ci.providerName
+}
+
 func (ci *CIInfo) SkipCount() int {
 	return ci.skipCount
 }
@@ -94,6 +135,9 @@ func (ci *CIInfo) extractFullInfo() {
 	case CodeBuild:
 		ci.extractFullInfoFromCodeBuild()
 
+	case Custom:
+		ci.extractFullInfoFromCustom()
+
 	case GitHubActions:
 		ci.extractFullInfoFromGitHubActions()
 
@@ -115,45 +159,108 @@ func (ci *CIInfo) extractFullInfo() {
 }
 
 func (ci *CIInfo) extractFullInfoFromAppCenter() {
-	ci.gitBranch = os.Getenv("APPCENTER_BRANCH")
-	ci.gitCommit = "" //os.Getenv("???") -- not currently supported?
+	ci.gitBranch = ci.getenv("APPCENTER_BRANCH")
+	ci.gitCommit = "" //ci.getenv("???") -- not currently supported?
 }
 
 func (ci *CIInfo) extractFullInfoFromAzureDevOps() {
-	ci.gitBranch = os.Getenv("BUILD_SOURCEBRANCHNAME")
-	ci.gitCommit = os.Getenv("BUILD_SOURCEVERSION")
+	ci.baseBranch = refNameToBranchNameIfQualified(ci.getenv("SYSTEM_PULLREQUEST_TARGETBRANCH"))
+	ci.gitBranch = ci.getenv("BUILD_SOURCEBRANCHNAME")
+	ci.gitCommit = ci.getenv("BUILD_SOURCEVERSION")
 }
 
 func (ci *CIInfo) extractFullInfoFromBitrise() {
-	ci.gitBranch = os.Getenv("BITRISE_GIT_BRANCH")
-	ci.gitCommit = os.Getenv("BITRISE_GIT_COMMIT")
+	ci.baseBranch = ci.getenv("BITRISEIO_GIT_BRANCH_DEST")
+	ci.gitBranch = ci.getenv("BITRISE_GIT_BRANCH")
+	ci.gitCommit = ci.getenv("BITRISE_GIT_COMMIT")
 }
 
 func (ci *CIInfo) extractFullInfoFromCircleCI() {
-	ci.gitBranch = os.Getenv("CIRCLE_BRANCH")
-	ci.gitCommit = os.Getenv("CIRCLE_SHA1")
+	ci.gitBranch = ci.getenv("CIRCLE_BRANCH")
+	ci.gitCommit = ci.getenv("CIRCLE_SHA1")
 }
 
 func (ci *CIInfo) extractFullInfoFromCodeBuild() {
-	trigger := os.Getenv("CODEBUILD_WEBHOOK_TRIGGER")
+	ci.gitCommit = ci.getenv("CODEBUILD_RESOLVED_SOURCE_VERSION")
+
+	trigger := ci.getenv("CODEBUILD_WEBHOOK_TRIGGER")
 
-	if strings.HasPrefix(trigger, "branch/") {
+	switch {
+	case strings.HasPrefix(trigger, "branch/"):
 		ci.gitBranch = strings.TrimPrefix(trigger, "branch/")
-	} else {
+
+	case strings.HasPrefix(trigger, "pr/"):
+		ci.baseBranch = refNameToBranchNameIfQualified(ci.getenv("CODEBUILD_WEBHOOK_BASE_REF"))
+		ci.gitBranch = refNameToBranchName(ci.getenv("CODEBUILD_WEBHOOK_HEAD_REF"))
+		ci.prNumber = parsePRNumber(strings.TrimPrefix(trigger, "pr/"))
+
+	case strings.HasPrefix(trigger, "tag/"):
+		ci.gitBranch = "" // tags are not branches
+
+	case len(trigger) == 0:
+		//
+		// Not triggered by a webhook (most likely started manually or from a
+		// pipeline), so fall back to the source version that was requested:
+		//
+		ci.extractSourceVersionFromCodeBuild(ci.getenv("CODEBUILD_SOURCE_VERSION"))
+
+	default:
 		ci.gitBranch = ""
 	}
+}
+
+func (ci *CIInfo) extractFullInfoFromCustom() {
+	ci.baseBranch = refNameToBranchNameIfQualified(ci.getenvIfNamed(ci.custom.baseBranchVar))
+	ci.buildURL = ci.getenvIfNamed(ci.custom.buildURLVar)
+	ci.gitBranch = refNameToBranchNameIfQualified(ci.getenvIfNamed(ci.custom.branchVar))
+	ci.gitCommit = ci.getenvIfNamed(ci.custom.commitVar)
+	ci.prNumber = parsePRNumber(ci.getenvIfNamed(ci.custom.prNumberVar))
+}
+
+func (ci *CIInfo) extractSourceVersionFromCodeBuild(version string) {
+	switch {
+	case len(version) == 0:
+		ci.gitBranch = ""
+
+	case strings.HasPrefix(version, "pr/"):
+		ci.gitBranch = ""
+		ci.prNumber = parsePRNumber(strings.TrimPrefix(version, "pr/"))
+
+	case strings.HasPrefix(version, "refs/heads/"):
+		ci.gitBranch = strings.TrimPrefix(version, "refs/heads/")
+
+	case strings.HasPrefix(version, "refs/"):
+		ci.gitBranch = "" // most likely a tag
+
+	case isCommitHash(version):
+		ci.gitBranch = ""
+
+		if len(ci.gitCommit) == 0 {
+			ci.gitCommit = version
+		}
+
+	case len(ci.gitCommit) > 0:
+		//
+		// Only a git source resolves to a commit, so the requested source
+		// version must be a plain branch name:
+		//
+		ci.gitBranch = version
 
-	ci.gitCommit = os.Getenv("CODEBUILD_WEBHOOK_PREV_COMMIT")
+	default:
+		ci.gitBranch = "" // most likely an S3 object version
+	}
 }
 
 func (ci *CIInfo) extractFullInfoFromGitHubActions() {
-	eventName := os.Getenv("GITHUB_EVENT_NAME")
-	refType := os.Getenv("GITHUB_REF_TYPE")
+	eventName := ci.getenv("GITHUB_EVENT_NAME")
+	refType := ci.getenv("GITHUB_REF_TYPE")
 
 	switch eventName {
 	case "pull_request", "pull_request_target":
+		ci.baseBranch = ci.getenv("GITHUB_BASE_REF")
+
 		if refType == "branch" {
-			ci.gitBranch = os.Getenv("GITHUB_HEAD_REF")
+			ci.gitBranch = ci.getenv("GITHUB_HEAD_REF")
 		} else {
 			ci.gitBranch = ""
 		}
@@ -163,18 +270,18 @@ func (ci *CIInfo) extractFullInfoFromGitHubActions() {
 		// a custom action) to match the current value of
 		// `github.event.pull_request.head.sha`:
 		//
-		ci.gitCommit = os.Getenv("GITHUB_EVENT_PULL_REQUEST_HEAD_SHA")
+		ci.gitCommit = ci.getenv("GITHUB_EVENT_PULL_REQUEST_HEAD_SHA")
 
 		ci.skipCount = 1
 
 	case "push":
 		if refType == "branch" {
-			ci.gitBranch = os.Getenv("GITHUB_REF_NAME")
+			ci.gitBranch = ci.getenv("GITHUB_REF_NAME")
 		} else {
 			ci.gitBranch = ""
 		}
 
-		ci.gitCommit = os.Getenv("GITHUB_SHA")
+		ci.gitCommit = ci.getenv("GITHUB_SHA")
 
 	default:
 		ci.gitBranch = ""
@@ -183,57 +290,84 @@ func (ci *CIInfo) extractFullInfoFromGitHubActions() {
 }
 
 func (ci *CIInfo) extractFullInfoFromJenkins() {
-	ci.gitBranch = "" //os.Getenv("???") -- not currently supported?
-	ci.gitCommit = "" //os.Getenv("???") -- not currently supported?
+	ci.gitBranch = "" //ci.getenv("???") -- not currently supported?
+	ci.gitCommit = "" //ci.getenv("???") -- not currently supported?
 }
 
 func (ci *CIInfo) extractFullInfoFromTeamCity() {
-	ci.gitBranch = "" //os.Getenv("???") -- not currently supported?
-	ci.gitCommit = "" //os.Getenv("???") -- not currently supported?
+	ci.gitBranch = "" //ci.getenv("???") -- not currently supported?
+	ci.gitCommit = "" //ci.getenv("???") -- not currently supported?
 }
 
 func (ci *CIInfo) extractFullInfoFromTravisCI() {
-	ci.gitBranch = os.Getenv("TRAVIS_BRANCH")
-	ci.gitCommit = os.Getenv("TRAVIS_COMMIT")
+	ci.gitBranch = ci.getenv("TRAVIS_BRANCH")
+	ci.gitCommit = ci.getenv("TRAVIS_COMMIT")
+
+	//
+	// For a pull request build, `TRAVIS_BRANCH` is the target branch:
+	//
+	if len(ci.getenv("TRAVIS_PULL_REQUEST_BRANCH")) > 0 {
+		ci.baseBranch = ci.gitBranch
+	}
 }
 
 func (ci *CIInfo) extractFullInfoFromXcodeCloud() {
-	ci.gitBranch = os.Getenv("CI_BRANCH")
-	ci.gitCommit = os.Getenv("CI_COMMIT")
+	ci.baseBranch = ci.getenv("CI_PULL_REQUEST_TARGET_BRANCH")
+	ci.gitBranch = ci.getenv("CI_BRANCH")
+	ci.gitCommit = ci.getenv("CI_COMMIT")
+}
+
+func (ci *CIInfo) getenv(key string) string {
+	if ci.env == nil {
+		return os.Getenv(key)
+	}
+
+	return ci.env.Getenv(key)
+}
+
+func (ci *CIInfo) getenvIfNamed(name string) string {
+	if len(name) == 0 {
+		return ""
+	}
+
+	return ci.getenv(name)
 }
 
 //-----------------------------------------------------------------------------
 
-func detectCIProvider() CIProvider {
+func detectCIProvider(custom *customCIConfig, env Environment) CIProvider {
 	switch {
-	case onAppCenter():
+	case custom != nil:
+		return Custom
+
+	case onAppCenter(env):
 		return AppCenter
 
-	case onAzureDevOps():
+	case onAzureDevOps(env):
 		return AzureDevOps
 
-	case onBitrise():
+	case onBitrise(env):
 		return Bitrise
 
-	case onCircleCI():
+	case onCircleCI(env):
 		return CircleCI
 
-	case onCodeBuild():
+	case onCodeBuild(env):
 		return CodeBuild
 
-	case onGitHubActions():
+	case onGitHubActions(env):
 		return GitHubActions
 
-	case onJenkins():
+	case onJenkins(env):
 		return Jenkins
 
-	case onTeamCity():
+	case onTeamCity(env):
 		return TeamCity
 
-	case onTravisCI():
+	case onTravisCI(env):
 		return TravisCI
 
-	case onXcodeCloud():
+	case onXcodeCloud(env):
 		return XcodeCloud
 
 	default:
@@ -241,42 +375,120 @@ func detectCIProvider() CIProvider {
 	}
 }
 
-func onAppCenter() bool {
-	return len(os.Getenv("APPCENTER_BUILD_ID")) > 0
+func isCommitHash(value string) bool {
+	if len(value) != 40 {
+		return false
+	}
+
+	for _, ch := range value {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", ch) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func onAppCenter(env Environment) bool {
+	return len(env.Getenv("APPCENTER_BUILD_ID")) > 0
+}
+
+func onAzureDevOps(env Environment) bool {
+	return len(env.Getenv("AGENT_ID")) > 0
+}
+
+func onBitrise(env Environment) bool {
+	return env.Getenv("BITRISE_IO") == "true"
 }
 
-func onAzureDevOps() bool {
-	return len(os.Getenv("AGENT_ID")) > 0
+func onCircleCI(env Environment) bool {
+	return env.Getenv("CIRCLECI") == "true"
 }
 
-func onBitrise() bool {
-	return os.Getenv("BITRISE_IO") == "true"
+func onCodeBuild(env Environment) bool {
+	return len(env.Getenv("CODEBUILD_BUILD_ID")) > 0
 }
 
-func onCircleCI() bool {
-	return os.Getenv("CIRCLECI") == "true"
+func onGitHubActions(env Environment) bool {
+	return env.Getenv("GITHUB_ACTIONS") == "true"
 }
 
-func onCodeBuild() bool {
-	return len(os.Getenv("CODEBUILD_BUILD_ID")) > 0
+func onJenkins(env Environment) bool {
+	return len(env.Getenv("JENKINS_URL")) > 0
 }
 
-func onGitHubActions() bool {
-	return os.Getenv("GITHUB_ACTIONS") == "true"
+func onTeamCity(env Environment) bool {
+	return len(env.Getenv("TEAMCITY_VERSION")) > 0
 }
 
-func onJenkins() bool {
-	return len(os.Getenv("JENKINS_URL")) > 0
+func onTravisCI(env Environment) bool {
+	return env.Getenv("TRAVIS") == "true"
 }
 
-func onTeamCity() bool {
-	return len(os.Getenv("TEAMCITY_VERSION")) > 0
+func onXcodeCloud(env Environment) bool {
+	return len(env.Getenv("CI_BUILD_ID")) > 0
 }
 
-func onTravisCI() bool {
-	return os.Getenv("TRAVIS") == "true"
+func refNameToBranchNameIfQualified(refName string) string {
+	if strings.HasPrefix(refName, "refs/") {
+		return refNameToBranchName(refName)
+	}
+
+	return strings.TrimSpace(refName)
 }
 
-func onXcodeCloud() bool {
-	return len(os.Getenv("CI_BUILD_ID")) > 0
+func parsePRNumber(value string) int {
+	number, err := strconv.Atoi(strings.TrimSpace(value))
+
+	if err != nil || number < 0 {
+		return 0
+	}
+
+	return number
+}
+
+//-----------------------------------------------------------------------------
+
+// A custom CI provider is declared entirely by the user, either through the
+// overrides map or through `WALDO_CI_*` environment variables (the overrides
+// take precedence). Each of the `*Var` settings holds the _name_ of the
+// environment variable that the CI system uses for that piece of information:
+//
+//	ciProvider      / WALDO_CI_PROVIDER         (required, e.g. “Drone”)
+//	ciBranchVar     / WALDO_CI_BRANCH_VAR       (e.g. “DRONE_SOURCE_BRANCH”)
+//	ciCommitVar     / WALDO_CI_COMMIT_VAR       (e.g. “DRONE_COMMIT_SHA”)
+//	ciPRNumberVar   / WALDO_CI_PR_NUMBER_VAR    (e.g. “DRONE_PULL_REQUEST”)
+//	ciBuildURLVar   / WALDO_CI_BUILD_URL_VAR    (e.g. “DRONE_BUILD_LINK”)
+//	ciBaseBranchVar / WALDO_CI_BASE_BRANCH_VAR  (e.g. “DRONE_TARGET_BRANCH”)
+type customCIConfig struct {
+	baseBranchVar string
+	branchVar     string
+	buildURLVar   string
+	commitVar     string
+	name          string
+	prNumberVar   string
+}
+
+func detectCustomCIConfig(overrides map[string]string, env Environment) *customCIConfig {
+	setting := func(key, envName string) string {
+		if value := strings.TrimSpace(overrides[key]); len(value) > 0 {
+			return value
+		}
+
+		return strings.TrimSpace(env.Getenv(envName))
+	}
+
+	name := setting("ciProvider", "WALDO_CI_PROVIDER")
+
+	if len(name) == 0 {
+		return nil
+	}
+
+	return &customCIConfig{
+		baseBranchVar: setting("ciBaseBranchVar", "WALDO_CI_BASE_BRANCH_VAR"),
+		branchVar:     setting("ciBranchVar", "WALDO_CI_BRANCH_VAR"),
+		buildURLVar:   setting("ciBuildURLVar", "WALDO_CI_BUILD_URL_VAR"),
+		commitVar:     setting("ciCommitVar", "WALDO_CI_COMMIT_VAR"),
+		name:          name,
+		prNumberVar:   setting("ciPRNumberVar", "WALDO_CI_PR_NUMBER_VAR")}
 }
@@ -0,0 +1,227 @@
+package waldo
+
+import (
+	"testing"
+)
+
+func codeBuildEnv(trigger, headRef, resolvedVersion, sourceVersion string) MapEnvironment {
+	return MapEnvironment{
+		"CODEBUILD_BUILD_ID":                "app:0123",
+		"CODEBUILD_RESOLVED_SOURCE_VERSION": resolvedVersion,
+		"CODEBUILD_SOURCE_VERSION":          sourceVersion,
+		"CODEBUILD_WEBHOOK_BASE_REF":        "refs/heads/main",
+		"CODEBUILD_WEBHOOK_HEAD_REF":        headRef,
+		"CODEBUILD_WEBHOOK_PREV_COMMIT":     "0000000000000000000000000000000000000000",
+		"CODEBUILD_WEBHOOK_TRIGGER":         trigger}
+}
+
+func detectCIInfoFixture(t *testing.T, provider CIProvider, env MapEnvironment) *CIInfo {
+	ci := DetectCIInfoWithOptions(true, InferOptions{Environment: env})
+
+	if ci.Provider() != provider {
+		t.Fatalf("Expected %v, got %v", provider, ci.Provider())
+	}
+
+	return ci
+}
+
+func TestCIProviderValuesAreStable(t *testing.T) {
+	if GitHubActions != 6 || XcodeCloud != 10 || Custom != 11 {
+		t.Errorf("Expected existing provider values to be unchanged, got %d, %d, %d", GitHubActions, XcodeCloud, Custom)
+	}
+
+	if name := XcodeCloud.String(); name != "Xcode Cloud" {
+		t.Errorf("Expected Xcode Cloud, got %s", name)
+	}
+}
+
+func TestCodeBuildBranchTrigger(t *testing.T) {
+	ci := detectCIInfoFixture(t, CodeBuild, codeBuildEnv("branch/main", "refs/heads/main", "1111111111111111111111111111111111111111", ""))
+
+	if ci.GitBranch() != "main" {
+		t.Errorf("Expected main, got %v", ci.GitBranch())
+	}
+
+	if ci.GitCommit() != "1111111111111111111111111111111111111111" {
+		t.Errorf("Expected resolved commit, got %v", ci.GitCommit())
+	}
+
+	if ci.PRNumber() != 0 {
+		t.Errorf("Expected no PR number, got %v", ci.PRNumber())
+	}
+}
+
+func TestCodeBuildManualBranch(t *testing.T) {
+	ci := detectCIInfoFixture(t, CodeBuild, codeBuildEnv("", "", "3333333333333333333333333333333333333333", "feature/manual"))
+
+	if ci.GitBranch() != "feature/manual" {
+		t.Errorf("Expected feature/manual, got %v", ci.GitBranch())
+	}
+
+	if ci.GitCommit() != "3333333333333333333333333333333333333333" {
+		t.Errorf("Expected resolved commit, got %v", ci.GitCommit())
+	}
+}
+
+func TestCodeBuildManualCommit(t *testing.T) {
+	ci := detectCIInfoFixture(t, CodeBuild, codeBuildEnv("", "", "", "4444444444444444444444444444444444444444"))
+
+	if ci.GitBranch() != "" {
+		t.Errorf("Expected empty branch, got %v", ci.GitBranch())
+	}
+
+	if ci.GitCommit() != "4444444444444444444444444444444444444444" {
+		t.Errorf("Expected source commit, got %v", ci.GitCommit())
+	}
+}
+
+func TestCodeBuildManualHeadsRef(t *testing.T) {
+	ci := detectCIInfoFixture(t, CodeBuild, codeBuildEnv("", "", "5555555555555555555555555555555555555555", "refs/heads/develop"))
+
+	if ci.GitBranch() != "develop" {
+		t.Errorf("Expected develop, got %v", ci.GitBranch())
+	}
+}
+
+func TestCodeBuildManualPullRequest(t *testing.T) {
+	ci := detectCIInfoFixture(t, CodeBuild, codeBuildEnv("", "", "6666666666666666666666666666666666666666", "pr/17"))
+
+	if ci.GitBranch() != "" {
+		t.Errorf("Expected empty branch, got %v", ci.GitBranch())
+	}
+
+	if ci.PRNumber() != 17 {
+		t.Errorf("Expected 17, got %v", ci.PRNumber())
+	}
+}
+
+func TestCodeBuildManualS3Source(t *testing.T) {
+	ci := detectCIInfoFixture(t, CodeBuild, codeBuildEnv("", "", "", "3sL4kqtJlcpXroDTDmJ+rmSpXd3dIbrHY"))
+
+	if ci.GitBranch() != "" {
+		t.Errorf("Expected empty branch, got %v", ci.GitBranch())
+	}
+
+	if ci.GitCommit() != "" {
+		t.Errorf("Expected empty commit, got %v", ci.GitCommit())
+	}
+}
+
+func TestCodeBuildPullRequestTrigger(t *testing.T) {
+	ci := detectCIInfoFixture(t, CodeBuild, codeBuildEnv("pr/42", "refs/heads/feature/login", "2222222222222222222222222222222222222222", "pr/42"))
+
+	if ci.GitBranch() != "feature/login" {
+		t.Errorf("Expected feature/login, got %v", ci.GitBranch())
+	}
+
+	if ci.GitCommit() != "2222222222222222222222222222222222222222" {
+		t.Errorf("Expected resolved commit, got %v", ci.GitCommit())
+	}
+
+	if ci.PRNumber() != 42 {
+		t.Errorf("Expected 42, got %v", ci.PRNumber())
+	}
+
+	if ci.BaseBranch() != "main" {
+		t.Errorf("Expected main, got %v", ci.BaseBranch())
+	}
+}
+
+func TestCodeBuildTagTrigger(t *testing.T) {
+	ci := detectCIInfoFixture(t, CodeBuild, codeBuildEnv("tag/v1.0.0", "refs/tags/v1.0.0", "7777777777777777777777777777777777777777", ""))
+
+	if ci.GitBranch() != "" {
+		t.Errorf("Expected empty branch, got %v", ci.GitBranch())
+	}
+
+	if ci.GitCommit() != "7777777777777777777777777777777777777777" {
+		t.Errorf("Expected resolved commit, got %v", ci.GitCommit())
+	}
+}
+
+func TestCustomFromEnvironment(t *testing.T) {
+	ci := detectCIInfoFixture(t, Custom, MapEnvironment{
+		"DRONE_BUILD_LINK":         "https://drone.example.com/acme/app/12",
+		"DRONE_COMMIT_SHA":         "8888888888888888888888888888888888888888",
+		"DRONE_PULL_REQUEST":       "9",
+		"DRONE_SOURCE_BRANCH":      "feature/drone",
+		"DRONE_TARGET_BRANCH":      "refs/heads/develop",
+		"WALDO_CI_BASE_BRANCH_VAR": "DRONE_TARGET_BRANCH",
+		"WALDO_CI_BRANCH_VAR":      "DRONE_SOURCE_BRANCH",
+		"WALDO_CI_BUILD_URL_VAR":   "DRONE_BUILD_LINK",
+		"WALDO_CI_COMMIT_VAR":      "DRONE_COMMIT_SHA",
+		"WALDO_CI_PROVIDER":        "Drone",
+		"WALDO_CI_PR_NUMBER_VAR":   "DRONE_PULL_REQUEST"})
+
+	if ci.ProviderName() != "Drone" {
+		t.Errorf("Expected Drone, got %v", ci.ProviderName())
+	}
+
+	if ci.GitBranch() != "feature/drone" {
+		t.Errorf("Expected feature/drone, got %v", ci.GitBranch())
+	}
+
+	if ci.GitCommit() != "8888888888888888888888888888888888888888" {
+		t.Errorf("Expected custom commit, got %v", ci.GitCommit())
+	}
+
+	if ci.PRNumber() != 9 {
+		t.Errorf("Expected 9, got %v", ci.PRNumber())
+	}
+
+	if ci.BuildURL() != "https://drone.example.com/acme/app/12" {
+		t.Errorf("Expected build URL, got %v", ci.BuildURL())
+	}
+
+	if ci.BaseBranch() != "develop" {
+		t.Errorf("Expected develop, got %v", ci.BaseBranch())
+	}
+}
+
+func TestCustomFromOverrides(t *testing.T) {
+	env := MapEnvironment{
+		"CI_COMMIT_BRANCH":  "refs/heads/main",
+		"CI_COMMIT_SHA":     "9999999999999999999999999999999999999999",
+		"WALDO_CI_PROVIDER": "Ignored"}
+
+	overrides := map[string]string{
+		"ciProvider":  "Woodpecker",
+		"ciBranchVar": "CI_COMMIT_BRANCH",
+		"ciCommitVar": "CI_COMMIT_SHA"}
+
+	ci := DetectCIInfoWithOptions(true, InferOptions{Environment: env, Overrides: overrides})
+
+	if ci.ProviderName() != "Woodpecker" {
+		t.Errorf("Expected Woodpecker, got %v", ci.ProviderName())
+	}
+
+	if ci.GitBranch() != "main" {
+		t.Errorf("Expected main, got %v", ci.GitBranch())
+	}
+
+	if ci.GitCommit() != "9999999999999999999999999999999999999999" {
+		t.Errorf("Expected custom commit, got %v", ci.GitCommit())
+	}
+
+	if ci.PRNumber() != 0 {
+		t.Errorf("Expected no PR number, got %v", ci.PRNumber())
+	}
+}
+
+func TestCustomNotDeclared(t *testing.T) {
+	if custom := detectCustomCIConfig(map[string]string{"ciBranchVar": "FOO"}, MapEnvironment{}); custom != nil {
+		t.Errorf("Expected nil, got %v", custom)
+	}
+}
+
+func TestTravisCIPullRequest(t *testing.T) {
+	ci := detectCIInfoFixture(t, TravisCI, MapEnvironment{
+		"TRAVIS":                     "true",
+		"TRAVIS_BRANCH":              "main",
+		"TRAVIS_COMMIT":              "3333333333333333333333333333333333333333",
+		"TRAVIS_PULL_REQUEST_BRANCH": "feature/travis"})
+
+	if ci.BaseBranch() != "main" {
+		t.Errorf("Expected main, got %v", ci.BaseBranch())
+	}
+}
@@ -32,7 +32,14 @@ func main() {
 
 	fmt.Printf("Git information for %s:\n\n", cd)
 	fmt.Printf("Access: %s\n", gitInfo.Access())
-	fmt.Printf("Branch: %s\n", gitInfo.Branch())
+	fmt.Printf("Branch: %s (rule: %s, candidates: %v)\n", gitInfo.Branch(), gitInfo.BranchRule(), gitInfo.CandidateBranches())
 	fmt.Printf("Commit: %s\n", gitInfo.Commit())
+	fmt.Printf("History: %s (detached HEAD: %v)\n", gitInfo.History(), gitInfo.IsDetachedHead())
+	fmt.Printf("Tags: %v (describe: %s)\n", gitInfo.Tags(), gitInfo.Describe())
+	fmt.Printf("Repository: %s (%s)\n", gitInfo.Remote().Identity(), gitInfo.Remote().URL())
+	fmt.Printf("Author: %s (%s)\n", gitInfo.AuthorName(), gitInfo.AuthorDate())
+	fmt.Printf("Subject: %s\n", gitInfo.CommitSubject())
+	fmt.Printf("Parents: %v\n", gitInfo.Parents())
+	fmt.Printf("Dirty: %v (%d modified, %d untracked)\n", gitInfo.IsDirty(), len(gitInfo.ModifiedFiles()), len(gitInfo.UntrackedFiles()))
 	fmt.Print("\n")
 }
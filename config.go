@@ -0,0 +1,337 @@
+package waldo
+
+import (
+	"net/http"
+	"regexp"
+)
+
+// Settings shared by Uploader and Triggerer. Fields that do not apply are
+// ignored (for example, BuildPath by a Triggerer). Any zero-valued field takes
+// its default value.
+type Config struct {
+	BuildEndpoint        string            // defaults to the Waldo API
+	BuildExpectations    BuildExpectations // Uploader only
+	BuildPath            string            // Uploader only
+	CABundlePaths        []string
+	ClientCertPath       string
+	ClientKeyPath        string
+	CommandRunner        CommandRunner // defaults to DefaultCommandRunner()
+	DryRun               bool
+	Environment          Environment    // defaults to DefaultEnvironment()
+	ErrorEndpoint        string         // defaults to the Waldo API
+	ErrorReporting       ErrorReporting // Uploader only
+	ErrorSpoolPath       string         // Uploader only, see WithErrorSpool
+	FlowMapPath          string         // Triggerer only, see WithFlowMap
+	GitBranch            string         // Uploader only
+	GitBranchPatterns    []string       // Uploader only
+	GitCommit            string         // Uploader only
+	GitDefaultBranch     DefaultBranchPreference
+	GitDefaultBranchName string
+	GitDiffHash          bool         // Uploader only, see WithGitDiffHash
+	GitPreferLocalBranch *bool        // Uploader only, defaults to true
+	GitTargetBranch      string       // Triggerer only
+	HTTPClient           *http.Client // overrides all other HTTP settings
+	Logger               Logger       // defaults to NopLogger() unless Verbose
+	Overrides            map[string]string
+	ProxyURL             string
+	RedactPatterns       []*regexp.Regexp
+	RuleName             string // Triggerer only
+	Timeouts             HTTPTimeouts
+	Transport            http.RoundTripper
+	TriggerEndpoint      string // defaults to the Waldo API
+	UploadToken          string
+	VariantName          string // Uploader only
+	Verbose              bool
+	WrapperName          string
+	WrapperVersion       string
+}
+
+// Checks applied to the build by Uploader.Validate, which fails with
+// ErrBuildMismatch if any is not met. Zero-valued fields are not checked.
+type BuildExpectations struct {
+	ABIs        []string // Android only, each must be present if the build has native code
+	Debuggable  bool     // Android only
+	PackageName string   // Android package name or iOS bundle identifier
+	Simulator   bool     // iOS only, always checked for an `.app` build
+}
+
+type Option func(*Config)
+
+//-----------------------------------------------------------------------------
+
+type Endpoint int
+
+const (
+	BuildEndpoint Endpoint = iota // MUST be first
+	ErrorEndpoint
+	TriggerEndpoint
+)
+
+func (e Endpoint) String() string {
+	return [...]string{
+		"build",
+		"error",
+		"trigger"}[e]
+}
+
+//-----------------------------------------------------------------------------
+
+func WithBuildExpectations(expectations BuildExpectations) Option {
+	return func(c *Config) {
+		c.BuildExpectations = expectations
+	}
+}
+
+func WithCommandRunner(runner CommandRunner) Option {
+	return func(c *Config) {
+		c.CommandRunner = runner
+	}
+}
+
+func WithEndpoint(endpoint Endpoint, url string) Option {
+	return func(c *Config) {
+		switch endpoint {
+		case BuildEndpoint:
+			c.BuildEndpoint = url
+
+		case ErrorEndpoint:
+			c.ErrorEndpoint = url
+
+		case TriggerEndpoint:
+			c.TriggerEndpoint = url
+		}
+	}
+}
+
+func WithEnvironment(env Environment) Option {
+	return func(c *Config) {
+		c.Environment = env
+	}
+}
+
+// Triggers only the flows affected by the files changed against the target
+// branch, as described by the flow mapping file at the given path.
+func WithFlowMap(path string) Option {
+	return func(c *Config) {
+		c.FlowMapPath = path
+	}
+}
+
+func WithGitBranch(branch string) Option {
+	return func(c *Config) {
+		c.GitBranch = branch
+	}
+}
+
+func WithGitBranchPatterns(patterns ...string) Option {
+	return func(c *Config) {
+		c.GitBranchPatterns = patterns
+	}
+}
+
+func WithGitCommit(commit string) Option {
+	return func(c *Config) {
+		c.GitCommit = commit
+	}
+}
+
+func WithGitDefaultBranch(preference DefaultBranchPreference, name string) Option {
+	return func(c *Config) {
+		c.GitDefaultBranch = preference
+		c.GitDefaultBranchName = name
+	}
+}
+
+// Sends a hash of the uncommitted changes with the build, when the working tree
+// is dirty. Off by default, since it requires running `git diff` over the
+// whole working tree.
+func WithGitDiffHash(enabled bool) Option {
+	return func(c *Config) {
+		c.GitDiffHash = enabled
+	}
+}
+
+// Whether to prefer local branches (the default) or remote branches when several
+// point at the commit.
+func WithGitPreferLocalBranch(preferLocal bool) Option {
+	return func(c *Config) {
+		c.GitPreferLocalBranch = &preferLocal
+	}
+}
+
+func WithGitTargetBranch(branch string) Option {
+	return func(c *Config) {
+		c.GitTargetBranch = branch
+	}
+}
+
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Config) {
+		c.HTTPClient = client
+	}
+}
+
+// Applies settings by key, as accepted by NewUploader and NewTriggerer. Keys
+// with a typed equivalent set the corresponding Config field; all keys remain
+// available in Config.Overrides. Keys not listed below are kept there but have
+// no effect. Empty values leave string settings unchanged.
+//
+//	apiBuildEndpoint            URL, see WithEndpoint(BuildEndpoint, …)
+//	apiErrorEndpoint            URL, see WithEndpoint(ErrorEndpoint, …)
+//	apiTriggerEndpoint          URL, see WithEndpoint(TriggerEndpoint, …)
+//	dryRun                      "true" or anything else for false, see WithDryRun
+//	errorReporting              "off", "false" or "0"; "dryrun" or "dry-run";
+//	                            "local", "localonly" or "local-only"; or
+//	                            anything else to send, see WithErrorReporting
+//	errorSpoolPath              directory path, see WithErrorSpool
+//	flowMapPath                 file path (Triggerer only), see WithFlowMap
+//	gitBranchPatterns           comma-separated glob patterns (Uploader only)
+//	gitDefaultBranchName        branch name (Uploader only), see WithGitDefaultBranch
+//	gitDefaultBranchPreference  "prefer", "avoid" or anything else to ignore
+//	                            (Uploader only), see WithGitDefaultBranch
+//	gitPreferLocalBranch        "false" or anything else for true (Uploader
+//	                            only), see WithGitPreferLocalBranch
+//	gitTargetBranch             branch name (Triggerer only), see WithGitTargetBranch
+//	wrapperName                 name, see WithWrapper
+//	wrapperVersion              version, see WithWrapper
+//
+// The custom CI provider keys (ciProvider, ciBranchVar, ciCommitVar,
+// ciPRNumberVar, ciBuildURLVar and ciBaseBranchVar) take precedence over the
+// equivalent WALDO_CI_* environment variables; each names the provider or the
+// environment variable holding the corresponding value.
+func WithOverrides(overrides map[string]string) Option {
+	return func(c *Config) {
+		if len(overrides) == 0 {
+			return
+		}
+
+		if c.Overrides == nil {
+			c.Overrides = make(map[string]string)
+		}
+
+		for key, value := range overrides {
+			c.Overrides[key] = value
+		}
+
+		setIfNotEmpty(&c.BuildEndpoint, overrides["apiBuildEndpoint"])
+		setIfNotEmpty(&c.ErrorEndpoint, overrides["apiErrorEndpoint"])
+		setIfNotEmpty(&c.ErrorSpoolPath, overrides["errorSpoolPath"])
+		setIfNotEmpty(&c.FlowMapPath, overrides["flowMapPath"])
+		setIfNotEmpty(&c.GitDefaultBranchName, overrides["gitDefaultBranchName"])
+		setIfNotEmpty(&c.GitTargetBranch, overrides["gitTargetBranch"])
+		setIfNotEmpty(&c.TriggerEndpoint, overrides["apiTriggerEndpoint"])
+		setIfNotEmpty(&c.WrapperName, overrides["wrapperName"])
+		setIfNotEmpty(&c.WrapperVersion, overrides["wrapperVersion"])
+
+		if patterns := splitList(overrides["gitBranchPatterns"]); len(patterns) > 0 {
+			c.GitBranchPatterns = patterns
+		}
+
+		if dryRun, found := overrides["dryRun"]; found {
+			c.DryRun = dryRun == "true"
+		}
+
+		if reporting, found := overrides["errorReporting"]; found {
+			c.ErrorReporting = parseErrorReporting(reporting)
+		}
+
+		if preference, found := overrides["gitDefaultBranchPreference"]; found {
+			c.GitDefaultBranch = parseDefaultBranchPreference(preference)
+		}
+
+		if preferLocal, found := overrides["gitPreferLocalBranch"]; found {
+			value := preferLocal != "false"
+
+			c.GitPreferLocalBranch = &value
+		}
+	}
+}
+
+func WithRuleName(ruleName string) Option {
+	return func(c *Config) {
+		c.RuleName = ruleName
+	}
+}
+
+func WithVariantName(variantName string) Option {
+	return func(c *Config) {
+		c.VariantName = variantName
+	}
+}
+
+func WithVerbose(verbose bool) Option {
+	return func(c *Config) {
+		c.Verbose = verbose
+	}
+}
+
+func WithWrapper(name, version string) Option {
+	return func(c *Config) {
+		c.WrapperName = name
+		c.WrapperVersion = version
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func (c *Config) apply(options []Option) {
+	for _, option := range options {
+		option(c)
+	}
+}
+
+func (c *Config) buildEndpoint() string {
+	return valueOrDefault(c.BuildEndpoint, defaultAPIBuildEndpoint)
+}
+
+func (c *Config) errorEndpoint() string {
+	return valueOrDefault(c.ErrorEndpoint, defaultAPIErrorEndpoint)
+}
+
+func (c *Config) errorSpoolPath() string {
+	if len(c.ErrorSpoolPath) == 0 && c.ErrorReporting == SpoolErrorReports {
+		return defaultErrorSpoolPath()
+	}
+
+	return c.ErrorSpoolPath
+}
+
+func (c *Config) setDefaults() {
+	if c.CommandRunner == nil {
+		c.CommandRunner = DefaultCommandRunner()
+	}
+
+	if c.Environment == nil {
+		c.Environment = DefaultEnvironment()
+	}
+
+	if c.Logger == nil {
+		c.Logger = defaultLogger(c.Verbose)
+	}
+}
+
+func (c *Config) triggerEndpoint() string {
+	return valueOrDefault(c.TriggerEndpoint, defaultAPITriggerEndpoint)
+}
+
+//-----------------------------------------------------------------------------
+
+func (be *BuildExpectations) isZero() bool {
+	return len(be.ABIs) == 0 && !be.Debuggable && len(be.PackageName) == 0 && !be.Simulator
+}
+
+//-----------------------------------------------------------------------------
+
+func setIfNotEmpty(field *string, value string) {
+	if len(value) > 0 {
+		*field = value
+	}
+}
+
+func valueOrDefault(value, defaultValue string) string {
+	if len(value) == 0 {
+		return defaultValue
+	}
+
+	return value
+}
@@ -0,0 +1,119 @@
+package waldo
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewTriggererWithOptions(t *testing.T) {
+	triggerer := NewTriggererWithOptions("0123456789abcdef0123456789abcdef",
+		WithEndpoint(TriggerEndpoint, "http://localhost:1234/suites"),
+		WithRuleName("smoke"),
+		WithWrapper("fastlane", "2.0.0"))
+
+	if triggerer.RuleName() != "smoke" {
+		t.Errorf("Expected smoke, got %v", triggerer.RuleName())
+	}
+
+	if triggerer.makeURL() != "http://localhost:1234/suites" {
+		t.Errorf("Expected trigger endpoint, got %v", triggerer.makeURL())
+	}
+
+	triggerer.ciInfo = &CIInfo{providerName: "Unknown"}
+
+	if payload := triggerer.makePayload(); !strings.Contains(payload, `"wrapperName":"fastlane"`) {
+		t.Errorf("Expected wrapper name, got %v", payload)
+	}
+
+	if userAgent := triggerer.userAgent(); userAgent != "Waldo Go CLI v2.0.0" {
+		t.Errorf("Expected wrapper version, got %v", userAgent)
+	}
+}
+
+func TestNewUploaderCompatibility(t *testing.T) {
+	overrides := map[string]string{
+		"apiBuildEndpoint":           "http://localhost:1234/versions",
+		"ciProvider":                 "Drone",
+		"gitBranchPatterns":          "release/*, main",
+		"gitDefaultBranchPreference": "avoid",
+		"wrapperName":                "fastlane"}
+
+	uploader := NewUploader("app.apk", "token", "release", "abc123", "main", true, overrides)
+	config := uploader.config
+
+	if config.BuildPath != "app.apk" || config.UploadToken != "token" || config.VariantName != "release" {
+		t.Errorf("Expected positional settings, got %+v", config)
+	}
+
+	if config.GitCommit != "abc123" || config.GitBranch != "main" || !config.Verbose {
+		t.Errorf("Expected positional git settings, got %+v", config)
+	}
+
+	if config.buildEndpoint() != "http://localhost:1234/versions" {
+		t.Errorf("Expected build endpoint, got %v", config.buildEndpoint())
+	}
+
+	if config.errorEndpoint() != defaultAPIErrorEndpoint {
+		t.Errorf("Expected default error endpoint, got %v", config.errorEndpoint())
+	}
+
+	if !reflect.DeepEqual(config.GitBranchPatterns, []string{"release/*", "main"}) {
+		t.Errorf("Expected branch patterns, got %v", config.GitBranchPatterns)
+	}
+
+	if config.GitDefaultBranch != AvoidDefaultBranch {
+		t.Errorf("Expected AvoidDefaultBranch, got %v", config.GitDefaultBranch)
+	}
+
+	if config.WrapperName != "fastlane" || config.Overrides["ciProvider"] != "Drone" {
+		t.Errorf("Expected wrapper name and custom CI override, got %+v", config)
+	}
+
+	if config.CommandRunner == nil || config.Environment == nil {
+		t.Errorf("Expected default runner and environment")
+	}
+}
+
+func TestNewUploaderWithOptions(t *testing.T) {
+	client := &http.Client{}
+
+	uploader := NewUploaderWithOptions("app.apk", "token",
+		WithGitBranch("feature"),
+		WithGitCommit("abc123"),
+		WithHTTPClient(client),
+		WithVariantName("debug"))
+
+	if uploader.GitBranch() != "feature" || uploader.GitCommit() != "abc123" || uploader.VariantName() != "debug" {
+		t.Errorf("Expected options to apply, got %+v", uploader.config)
+	}
+
+	if supplied, _ := uploader.config.newHTTPClient(); supplied != client {
+		t.Errorf("Expected supplied HTTP client")
+	}
+
+	if uploader.config.buildEndpoint() != defaultAPIBuildEndpoint {
+		t.Errorf("Expected default build endpoint, got %v", uploader.config.buildEndpoint())
+	}
+}
+
+func TestUploaderBranchPolicy(t *testing.T) {
+	for _, uploader := range []*Uploader{
+		NewUploaderWithOptions("app.apk", "token", WithGitPreferLocalBranch(false)),
+		NewUploader("app.apk", "token", "", "", "", false, map[string]string{"gitPreferLocalBranch": "false"})} {
+		uploader.ciInfo = &CIInfo{}
+
+		if policy := uploader.branchPolicy(); policy.PreferLocal || !policy.PreferRemote {
+			t.Errorf("Expected remote branches to be preferred, got %+v", policy)
+		}
+	}
+
+	uploader := NewUploaderWithOptions("app.apk", "token")
+
+	uploader.ciInfo = &CIInfo{}
+
+	if policy := uploader.branchPolicy(); !policy.PreferLocal || policy.PreferRemote {
+		t.Errorf("Expected local branches to be preferred, got %+v", policy)
+	}
+}
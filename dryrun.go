@@ -0,0 +1,83 @@
+package waldo
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Describes the request that Uploader or Triggerer would have sent in dry-run
+// mode. Secrets in the URL, headers and body are redacted.
+type DryRunRequest struct {
+	Body   string // empty for a build upload, see Size
+	Header http.Header
+	Method string
+	Size   int64
+	URL    string
+}
+
+//-----------------------------------------------------------------------------
+
+// Does everything short of contacting Waldo: validation, CI detection, git
+// inference and payload creation all take place, then the request that would
+// have been sent is logged (and available from DryRunRequest) instead. Error
+// reports are logged rather than sent.
+func WithDryRun(dryRun bool) Option {
+	return func(c *Config) {
+		c.DryRun = dryRun
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func (drr *DryRunRequest) String() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "%s %s\n", drr.Method, drr.URL)
+
+	keys := make([]string, 0, len(drr.Header))
+
+	for key := range drr.Header {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		for _, value := range drr.Header[key] {
+			fmt.Fprintf(&sb, "%s: %s\n", key, value)
+		}
+	}
+
+	fmt.Fprintf(&sb, "Size: %d bytes\n", drr.Size)
+
+	if len(drr.Body) > 0 {
+		fmt.Fprintf(&sb, "\n%s\n", drr.Body)
+	}
+
+	return sb.String()
+}
+
+//-----------------------------------------------------------------------------
+
+func logDryRunRequest(logger Logger, req *http.Request, body string, size int64, r *redactor) *DryRunRequest {
+	header := make(http.Header, len(req.Header))
+
+	for key, values := range req.Header {
+		for _, value := range values {
+			header.Add(key, strings.TrimPrefix(r.redact(key+": "+value), key+": "))
+		}
+	}
+
+	drr := &DryRunRequest{
+		Body:   r.redact(body),
+		Header: header,
+		Method: req.Method,
+		Size:   size,
+		URL:    r.redact(req.URL.String())}
+
+	logger.Log(LevelInfo, "Dry run (not sent)", Field("request", drr.String()))
+
+	return drr
+}
@@ -0,0 +1,117 @@
+package waldo_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/waldoapp/waldo-go-lib"
+)
+
+func TestTriggererDryRun(t *testing.T) {
+	server := newServer(t)
+	logger := &recordingLogger{}
+
+	triggerer := waldo.NewTriggererWithOptions(secretUploadToken, serverOptions(server,
+		waldo.WithDryRun(true),
+		waldo.WithLogger(logger),
+		waldo.WithRuleName("smoke"))...)
+
+	err := triggerer.Validate()
+
+	if err == nil {
+		err = triggerer.Perform()
+	}
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	request := triggerer.DryRunRequest()
+
+	if request == nil || request.URL != server.URL()+"/suites" || !strings.Contains(request.Body, `"ruleName":"smoke"`) {
+		t.Fatalf("Expected dry-run request, got %+v", request)
+	}
+
+	if request.Size != int64(len(request.Body)) {
+		t.Errorf("Expected size %d, got %d", len(request.Body), request.Size)
+	}
+
+	output := strings.Join(logger.entries, "\n")
+
+	if !strings.Contains(output, "info Dry run (not sent)") || strings.Contains(output, secretUploadToken) {
+		t.Errorf("Expected redacted dry-run output, got %q", output)
+	}
+
+	if requests := server.Requests(); len(requests) != 0 {
+		t.Errorf("Expected no requests, got %d", len(requests))
+	}
+}
+
+func TestUploaderDryRun(t *testing.T) {
+	server := newServer(t)
+	logger := &recordingLogger{}
+
+	buildPath := filepath.Join(t.TempDir(), "My.app")
+
+	os.MkdirAll(buildPath, 0755)
+	os.WriteFile(filepath.Join(buildPath, "Info.plist"), []byte("plist"), 0644)
+
+	uploader := waldo.NewUploaderWithOptions(buildPath, secretUploadToken, serverOptions(server,
+		waldo.WithDryRun(true),
+		waldo.WithLogger(logger))...)
+
+	err := uploader.Validate()
+
+	if err == nil {
+		err = uploader.Upload()
+	}
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	request := uploader.DryRunRequest()
+
+	if request == nil || !strings.HasPrefix(request.URL, server.URL()+"/versions?") || request.Size == 0 {
+		t.Fatalf("Expected dry-run request, got %+v", request)
+	}
+
+	if value := request.Header.Get("Authorization"); value != "Upload-Token [REDACTED]" {
+		t.Errorf("Expected redacted authorization, got %q", value)
+	}
+
+	if value := request.Header.Get("Content-Type"); value != "application/zip" {
+		t.Errorf("Expected zip content type, got %q", value)
+	}
+
+	if output := strings.Join(logger.entries, "\n"); !strings.Contains(output, "info Dry run (not sent)") || strings.Contains(output, secretUploadToken) {
+		t.Errorf("Expected redacted dry-run output, got %q", output)
+	}
+
+	if requests := server.Requests(); len(requests) != 0 {
+		t.Errorf("Expected no requests, got %d", len(requests))
+	}
+}
+
+func TestUploaderDryRunPrintsErrorReport(t *testing.T) {
+	server := newServer(t)
+	logger := &recordingLogger{}
+
+	uploader := waldo.NewUploaderWithOptions(filepath.Join(t.TempDir(), "missing.apk"), secretUploadToken, serverOptions(server,
+		waldo.WithDryRun(true),
+		waldo.WithLogger(logger))...)
+
+	if err := uploader.Validate(); err == nil {
+		uploader.Upload()
+	}
+
+	if output := strings.Join(logger.entries, "\n"); !strings.Contains(output, "info Error report (not sent)") {
+		t.Errorf("Expected logged error report, got %q", output)
+	}
+
+	if requests := server.Requests(); len(requests) != 0 {
+		t.Errorf("Expected no requests, got %d", len(requests))
+	}
+}
@@ -0,0 +1,116 @@
+package waldo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type ErrorReporting int
+
+const (
+	SendErrorReports    ErrorReporting = iota // MUST be first
+	DisableErrorReports                       // never send or keep error reports
+	PrintErrorReports                         // log error reports instead of sending them, to stdout by default
+	SpoolErrorReports                         // keep error reports on disk only
+)
+
+func (er ErrorReporting) String() string {
+	return [...]string{
+		"on",
+		"off",
+		"dryRun",
+		"localOnly"}[er]
+}
+
+//-----------------------------------------------------------------------------
+
+// Controls what Uploader does with a report of any failure, which carries the
+// (redacted) error message along with CI and platform information. By default
+// the report is sent to Waldo.
+func WithErrorReporting(reporting ErrorReporting) Option {
+	return func(c *Config) {
+		c.ErrorReporting = reporting
+	}
+}
+
+// Keeps error reports that cannot be sent in the given directory, and sends
+// them on the next successful upload. With SpoolErrorReports, all error reports
+// are kept there and none are sent.
+func WithErrorSpool(dirPath string) Option {
+	return func(c *Config) {
+		c.ErrorSpoolPath = dirPath
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func defaultErrorSpoolPath() string {
+	cachePath, err := os.UserCacheDir()
+
+	if err != nil {
+		cachePath = os.TempDir()
+	}
+
+	return filepath.Join(cachePath, "Waldo", "ErrorReports")
+}
+
+func parseErrorReporting(value string) ErrorReporting {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "off", "false", "0":
+		return DisableErrorReports
+
+	case "dryrun", "dry-run":
+		return PrintErrorReports
+
+	case "localonly", "local-only", "local":
+		return SpoolErrorReports
+
+	default:
+		return SendErrorReports
+	}
+}
+
+func spooledErrorReports(dirPath string) []string {
+	entries, err := os.ReadDir(dirPath)
+
+	if err != nil {
+		return nil
+	}
+
+	var paths []string
+
+	for _, entry := range entries { // sorted by name, hence oldest first
+		if entry.Type().IsRegular() && strings.HasSuffix(entry.Name(), ".json") {
+			paths = append(paths, filepath.Join(dirPath, entry.Name()))
+		}
+	}
+
+	return paths
+}
+
+func writeErrorReport(dirPath, body string) (string, error) {
+	err := os.MkdirAll(dirPath, 0700)
+
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.CreateTemp(dirPath, fmt.Sprintf("error-%d-*.json", time.Now().UnixNano()))
+
+	if err != nil {
+		return "", err
+	}
+
+	defer file.Close()
+
+	if _, err = file.WriteString(body); err != nil {
+		os.Remove(file.Name())
+
+		return "", err
+	}
+
+	return file.Name(), nil
+}
@@ -0,0 +1,18 @@
+package waldo
+
+import (
+	"testing"
+)
+
+func TestParseErrorReporting(t *testing.T) {
+	for value, expected := range map[string]ErrorReporting{
+		"":          SendErrorReports,
+		"dry-run":   PrintErrorReports,
+		"localOnly": SpoolErrorReports,
+		"off":       DisableErrorReports,
+		"on":        SendErrorReports} {
+		if reporting := parseErrorReporting(value); reporting != expected {
+			t.Errorf("Expected %v for %q, got %v", expected, value, reporting)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package waldo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+)
+
+// Returned (wrapped) when a request to Waldo could not be completed, for
+// example because the host is unreachable or the connection timed out. The
+// underlying cause is available via errors.Unwrap.
+type NetworkError struct {
+	Action string // for example, "upload build to Waldo"
+	Err    error
+	URL    string
+}
+
+// Returned (wrapped) when Waldo rejects a request. Matches ErrServer, and also
+// ErrInvalidUploadToken or ErrRateLimited depending on the status.
+type ServerError struct {
+	Action string // for example, "upload build to Waldo"
+	Body   string
+	Status int
+}
+
+type categorizedError struct {
+	category error
+	cause    error
+	message  string
+}
+
+//-----------------------------------------------------------------------------
+
+var (
+	ErrBuildMismatch        = errors.New("Build does not meet expectations")
+	ErrInvalidBuildPath     = errors.New("Invalid build path")
+	ErrInvalidUploadToken   = errors.New("Upload token is invalid or missing!")
+	ErrNetwork              = errors.New("Unable to reach Waldo")
+	ErrRateLimited          = errors.New("Rate limited by Waldo")
+	ErrServer               = errors.New("Request rejected by Waldo")
+	ErrUnsupportedBuildType = errors.New("Unsupported build type")
+)
+
+//-----------------------------------------------------------------------------
+
+func (ne *NetworkError) Error() string {
+	return fmt.Sprintf("Unable to %s, error: %v, url: %s", ne.Action, ne.Err, ne.URL)
+}
+
+func (ne *NetworkError) Is(target error) bool {
+	return target == ErrNetwork
+}
+
+func (ne *NetworkError) Unwrap() error {
+	return ne.Err
+}
+
+//-----------------------------------------------------------------------------
+
+func (se *ServerError) Error() string {
+	if se.Status == http.StatusUnauthorized {
+		return ErrInvalidUploadToken.Error()
+	}
+
+	return fmt.Sprintf("Unable to %s, HTTP status: %d", se.Action, se.Status)
+}
+
+func (se *ServerError) Is(target error) bool {
+	switch target {
+	case ErrInvalidUploadToken:
+		return se.Status == http.StatusUnauthorized
+
+	case ErrRateLimited:
+		return se.Status == http.StatusTooManyRequests
+
+	case ErrServer:
+		return true
+
+	default:
+		return false
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func (ce *categorizedError) Error() string {
+	return ce.message
+}
+
+func (ce *categorizedError) Is(target error) bool {
+	return target == ce.category
+}
+
+func (ce *categorizedError) Unwrap() error {
+	return ce.cause
+}
+
+//-----------------------------------------------------------------------------
+
+func checkResponseStatus(resp *http.Response, action string) error {
+	body, err := io.ReadAll(resp.Body)
+
+	if err != nil {
+		return &NetworkError{
+			Action: action,
+			Err:    err,
+			URL:    resp.Request.URL.String()}
+	}
+
+	bodyString := string(body)
+
+	statusRegex := regexp.MustCompile(`"status":([0-9]+)`)
+	statusMatches := statusRegex.FindStringSubmatch(bodyString)
+
+	status := resp.StatusCode
+
+	//
+	// Waldo may also report a failure in the body of a 2xx response (where the
+	// status is numeric _only_ on failure), but never hides one that way:
+	//
+	if status >= 200 && status <= 299 && len(statusMatches) > 0 {
+		if status, err = strconv.Atoi(statusMatches[1]); err != nil {
+			return err
+		}
+	}
+
+	if status < 200 || status > 299 {
+		return &ServerError{
+			Action: action,
+			Body:   bodyString,
+			Status: status}
+	}
+
+	return nil
+}
+
+func newCategorizedError(category, cause error, format string, args ...interface{}) error {
+	return &categorizedError{
+		category: category,
+		cause:    cause,
+		message:  fmt.Sprintf(format, args...)}
+}
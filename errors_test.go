@@ -0,0 +1,140 @@
+package waldo_test
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/waldoapp/waldo-go-lib"
+	"github.com/waldoapp/waldo-go-lib/waldotest"
+)
+
+func TestErrInvalidBuildPath(t *testing.T) {
+	server := newServer(t)
+
+	for _, buildPath := range []string{"", filepath.Join(t.TempDir(), "missing.apk")} {
+		uploader := waldo.NewUploaderWithOptions(buildPath, secretUploadToken, serverOptions(server)...)
+
+		err := uploader.Validate()
+
+		if err == nil {
+			err = uploader.Upload()
+		}
+
+		if !errors.Is(err, waldo.ErrInvalidBuildPath) {
+			t.Errorf("Expected ErrInvalidBuildPath for %q, got %v", buildPath, err)
+		}
+	}
+}
+
+func TestErrInvalidUploadToken(t *testing.T) {
+	err := waldo.NewTriggererWithOptions("").Validate()
+
+	if !errors.Is(err, waldo.ErrInvalidUploadToken) || err.Error() != "Empty upload token" {
+		t.Errorf("Expected ErrInvalidUploadToken, got %v", err)
+	}
+
+	server := newServer(t)
+
+	server.Enqueue(waldo.BuildEndpoint, waldotest.Response{Body: `{"status":401,"message":"Bad token"}`})
+
+	err = upload(t, server)
+
+	if !errors.Is(err, waldo.ErrInvalidUploadToken) || !errors.Is(err, waldo.ErrServer) {
+		t.Errorf("Expected ErrInvalidUploadToken, got %v", err)
+	}
+}
+
+func TestErrNetwork(t *testing.T) {
+	err := upload(t, newServer(t),
+		waldo.WithEndpoint(waldo.BuildEndpoint, "http://127.0.0.1:1/versions"),
+		waldo.WithEndpoint(waldo.ErrorEndpoint, "http://127.0.0.1:1/uploadError"))
+
+	var networkErr *waldo.NetworkError
+
+	if !errors.Is(err, waldo.ErrNetwork) || !errors.As(err, &networkErr) {
+		t.Fatalf("Expected NetworkError, got %v", err)
+	}
+
+	if networkErr.Err == nil || !strings.HasPrefix(networkErr.URL, "http://127.0.0.1:1/versions?") {
+		t.Errorf("Expected cause and URL, got %+v", networkErr)
+	}
+}
+
+func TestErrNetworkMidUpload(t *testing.T) {
+	server := newServer(t)
+
+	server.Enqueue(waldo.BuildEndpoint, waldotest.Response{FailAfter: 1})
+
+	if err := upload(t, server); !errors.Is(err, waldo.ErrNetwork) {
+		t.Errorf("Expected ErrNetwork, got %v", err)
+	}
+
+	if builds := server.RequestsTo(waldo.BuildEndpoint); len(builds) != 1 || len(builds[0].Body) != 1 {
+		t.Errorf("Expected 1 partial build, got %v", builds)
+	}
+}
+
+func TestErrRateLimited(t *testing.T) {
+	server := newServer(t)
+
+	server.Enqueue(waldo.BuildEndpoint, waldotest.Response{Body: "Slow down", Status: http.StatusTooManyRequests})
+
+	err := upload(t, server)
+
+	var serverErr *waldo.ServerError
+
+	if !errors.Is(err, waldo.ErrRateLimited) || !errors.As(err, &serverErr) {
+		t.Fatalf("Expected ErrRateLimited, got %v", err)
+	}
+
+	if serverErr.Status != http.StatusTooManyRequests || serverErr.Body != "Slow down" {
+		t.Errorf("Expected status and body, got %+v", serverErr)
+	}
+}
+
+func TestErrServer(t *testing.T) {
+	server := newServer(t)
+
+	server.Enqueue(waldo.BuildEndpoint, waldotest.Response{Body: `{"status":500,"message":"Oops"}`})
+
+	err := upload(t, server)
+
+	var serverErr *waldo.ServerError
+
+	if !errors.As(err, &serverErr) || serverErr.Status != 500 {
+		t.Fatalf("Expected ServerError, got %v", err)
+	}
+
+	if errors.Is(err, waldo.ErrInvalidUploadToken) || errors.Is(err, waldo.ErrRateLimited) {
+		t.Errorf("Expected generic server error, got %v", err)
+	}
+
+	if err.Error() != "Unable to upload build to Waldo, HTTP status: 500" {
+		t.Errorf("Expected unchanged message, got %q", err.Error())
+	}
+}
+
+func TestErrServerStatusNotMasked(t *testing.T) {
+	server := newServer(t)
+
+	server.Enqueue(waldo.BuildEndpoint, waldotest.Response{Body: `{"status":200}`, Status: http.StatusInternalServerError})
+
+	err := upload(t, server)
+
+	var serverErr *waldo.ServerError
+
+	if !errors.As(err, &serverErr) || serverErr.Status != http.StatusInternalServerError {
+		t.Errorf("Expected ServerError with status 500, got %v", err)
+	}
+}
+
+func TestErrUnsupportedBuildType(t *testing.T) {
+	err := waldo.NewUploaderWithOptions("app.exe", secretUploadToken).Validate()
+
+	if !errors.Is(err, waldo.ErrUnsupportedBuildType) {
+		t.Errorf("Expected ErrUnsupportedBuildType, got %v", err)
+	}
+}
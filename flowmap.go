@@ -0,0 +1,112 @@
+package waldo
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// A flow mapping file maps changed paths to the Waldo flows they affect. Each
+// non-blank line that does not start with `#` holds a glob pattern, an arrow
+// (`->` or `→`) and a comma-separated list of targets. A target is either a
+// flow name (which may itself contain wildcards) or a flow tag, written as
+// `tag:<name>`. Patterns are matched against paths relative to the root of the
+// repository; `**` matches any number of directories. An empty list of targets
+// marks paths that do not affect any flow:
+//
+//	ios/Checkout/**   -> checkout-*
+//	shared/Login/**   -> login, tag:smoke
+//	**/*.md           ->
+type flowMapping struct {
+	pattern *regexp.Regexp
+	targets []string
+}
+
+//-----------------------------------------------------------------------------
+
+func loadFlowMap(path string) ([]flowMapping, error) {
+	content, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read flow mapping file: %s", path)
+	}
+
+	return parseFlowMap(string(content))
+}
+
+func parseFlowMap(content string) ([]flowMapping, error) {
+	var mappings []flowMapping
+
+	for idx, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.Replace(line, "→", "->", 1)
+
+		arrow := strings.Index(line, "->")
+
+		if arrow == -1 {
+			return nil, fmt.Errorf("Invalid flow mapping on line %d: %s", idx+1, line)
+		}
+
+		glob := strings.TrimPrefix(strings.TrimSpace(line[:arrow]), "/")
+
+		if len(glob) == 0 {
+			return nil, fmt.Errorf("Missing pattern in flow mapping on line %d", idx+1)
+		}
+
+		pattern, err := regexp.Compile(gitGlobToRegexp(glob))
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid pattern in flow mapping on line %d: %s", idx+1, glob)
+		}
+
+		mappings = append(mappings, flowMapping{
+			pattern: pattern,
+			targets: splitList(line[arrow+2:])})
+	}
+
+	return mappings, nil
+}
+
+// Returns the flow names and flow tags affected by the given paths. The last
+// result is false if any path is not matched by a mapping, in which case the
+// affected flows cannot be determined. When every path is matched only by
+// mappings without targets, the last result is true and both lists are empty:
+// no flow is affected.
+func selectFlows(mappings []flowMapping, paths []string) ([]string, []string, bool) {
+	names := make(map[string]bool)
+	tags := make(map[string]bool)
+
+	for _, path := range paths {
+		matched := false
+
+		for _, mapping := range mappings {
+			if !mapping.pattern.MatchString(path) {
+				continue
+			}
+
+			matched = true
+
+			for _, target := range mapping.targets {
+				if tag := strings.TrimSpace(strings.TrimPrefix(target, "tag:")); tag != target {
+					if len(tag) > 0 {
+						tags[tag] = true
+					}
+				} else {
+					names[target] = true
+				}
+			}
+		}
+
+		if !matched {
+			return nil, nil, false
+		}
+	}
+
+	return sortedKeys(names), sortedKeys(tags), true
+}
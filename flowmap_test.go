@@ -0,0 +1,147 @@
+package waldo
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFlowMapInvalid(t *testing.T) {
+	if _, err := parseFlowMap("ios/Checkout/** checkout-*\n"); err == nil {
+		t.Errorf("Expected error, got nil")
+	}
+}
+
+func TestSelectFlows(t *testing.T) {
+	mappings, err := parseFlowMap(`
+# Checkout screens
+ios/Checkout/**   -> checkout-*
+shared/Login/**   → login, tag:smoke
+**/*.md           ->
+`)
+
+	if err != nil {
+		t.Fatalf("Expected mappings, got %v", err)
+	}
+
+	names, tags, complete := selectFlows(mappings, []string{"ios/Checkout/Cart/View.swift", "shared/Login/Form.swift", "docs/README.md"})
+
+	if !complete {
+		t.Errorf("Expected complete selection")
+	}
+
+	if !reflect.DeepEqual(names, []string{"checkout-*", "login"}) {
+		t.Errorf("Expected [checkout-* login], got %v", names)
+	}
+
+	if !reflect.DeepEqual(tags, []string{"smoke"}) {
+		t.Errorf("Expected [smoke], got %v", tags)
+	}
+}
+
+func TestSelectFlowsUnmatched(t *testing.T) {
+	mappings, _ := parseFlowMap("ios/Checkout/** -> checkout-*\n")
+
+	if _, _, complete := selectFlows(mappings, []string{"ios/Checkout/View.swift", "ios/Profile/View.swift"}); complete {
+		t.Errorf("Expected incomplete selection")
+	}
+}
+
+func TestTriggererFlowMap(t *testing.T) {
+	dir := gitFixture(t)
+
+	writeGitFixtureFile(t, dir, "README.md", "readme\n")
+	runGitFixture(t, dir, "add", "-A")
+	runGitFixture(t, dir, "commit", "--quiet", "-m", "Initial")
+	runGitFixture(t, dir, "checkout", "--quiet", "-b", "feature")
+	writeGitFixtureFile(t, dir, "ios/Checkout/View.swift", "view\n")
+	runGitFixture(t, dir, "add", "-A")
+	runGitFixture(t, dir, "commit", "--quiet", "-m", "Checkout")
+
+	mapPath := filepath.Join(t.TempDir(), "flows.map")
+
+	writeGitFixtureFile(t, filepath.Dir(mapPath), filepath.Base(mapPath), "ios/Checkout/** -> checkout-*\n")
+
+	chdirGitFixture(t, dir)
+
+	overrides := map[string]string{"flowMapPath": mapPath, "gitTargetBranch": "main"}
+	triggerer := NewTriggerer("0123456789abcdef0123456789abcdef", "all", false, overrides)
+
+	if err := triggerer.Validate(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if !reflect.DeepEqual(triggerer.FlowNames(), []string{"checkout-*"}) {
+		t.Errorf("Expected [checkout-*], got %v", triggerer.FlowNames())
+	}
+
+	payload := triggerer.makePayload()
+
+	if !strings.Contains(payload, `"flowNames":["checkout-*"]`) || strings.Contains(payload, "ruleName") {
+		t.Errorf("Expected flow names instead of rule name, got %s", payload)
+	}
+}
+
+func TestTriggererFlowMapFallback(t *testing.T) {
+	dir := gitFixture(t)
+
+	commitGitFixture(t, dir, 1)
+
+	mapPath := filepath.Join(t.TempDir(), "flows.map")
+
+	writeGitFixtureFile(t, filepath.Dir(mapPath), filepath.Base(mapPath), "ios/Checkout/** -> checkout-*\n")
+
+	chdirGitFixture(t, dir)
+
+	overrides := map[string]string{"flowMapPath": mapPath, "gitTargetBranch": "missing"}
+	triggerer := NewTriggerer("0123456789abcdef0123456789abcdef", "all", false, overrides)
+
+	if err := triggerer.Validate(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(triggerer.FlowNames()) > 0 || len(triggerer.FlowTags()) > 0 {
+		t.Errorf("Expected no selected flows, got %v %v", triggerer.FlowNames(), triggerer.FlowTags())
+	}
+
+	if payload := triggerer.makePayload(); !strings.Contains(payload, `"ruleName":"all"`) {
+		t.Errorf("Expected rule name, got %s", payload)
+	}
+}
+
+func TestTriggererFlowMapNoFlowsAffected(t *testing.T) {
+	dir := gitFixture(t)
+
+	writeGitFixtureFile(t, dir, "README.md", "readme\n")
+	runGitFixture(t, dir, "add", "-A")
+	runGitFixture(t, dir, "commit", "--quiet", "-m", "Initial")
+	runGitFixture(t, dir, "checkout", "--quiet", "-b", "feature")
+	writeGitFixtureFile(t, dir, "docs/Guide.md", "guide\n")
+	runGitFixture(t, dir, "add", "-A")
+	runGitFixture(t, dir, "commit", "--quiet", "-m", "Docs")
+
+	mapPath := filepath.Join(t.TempDir(), "flows.map")
+
+	writeGitFixtureFile(t, filepath.Dir(mapPath), filepath.Base(mapPath), "ios/Checkout/** -> checkout-*\n**/*.md ->\n")
+
+	chdirGitFixture(t, dir)
+
+	overrides := map[string]string{
+		"apiTriggerEndpoint": "http://127.0.0.1:1/suites",
+		"flowMapPath":        mapPath,
+		"gitTargetBranch":    "main"}
+	triggerer := NewTriggerer("0123456789abcdef0123456789abcdef", "all", false, overrides)
+
+	if err := triggerer.Validate(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if !triggerer.Skipped() {
+		t.Errorf("Expected skipped run, got %v %v", triggerer.FlowNames(), triggerer.FlowTags())
+	}
+
+	if err := triggerer.Perform(); err != nil {
+		t.Errorf("Expected no run to be triggered, got %v", err)
+	}
+}
@@ -1,16 +1,32 @@
 package waldo
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"fmt"
-	"os/exec"
+	"os"
 	"runtime"
 	"strings"
+	"time"
 )
 
 type GitInfo struct {
-	access GitAccess
-	branch string
-	commit string
+	access      GitAccess
+	branch      string
+	branchRule  BranchRule
+	candidates  []string
+	commit      string
+	describe    string
+	detached    bool
+	details     gitCommit
+	diffHash    string
+	history     GitHistory
+	modified    []string
+	nearestTag  string
+	remote      *GitRemote
+	tagDistance int
+	tags        []string
+	untracked   []string
 }
 
 //-----------------------------------------------------------------------------
@@ -32,24 +48,118 @@ func (ga GitAccess) String() string {
 
 //-----------------------------------------------------------------------------
 
+type GitHistory int
+
+const (
+	UnknownHistory GitHistory = iota // MUST be first
+	FullHistory
+	ShallowHistory
+	MissingParents
+)
+
+func (gh GitHistory) String() string {
+	return [...]string{
+		"unknown",
+		"full",
+		"shallow",
+		"missingParents"}[gh]
+}
+
+//-----------------------------------------------------------------------------
+
 func InferGitInfo(skipCount int) *GitInfo {
+	return InferGitInfoWithOptions(skipCount, InferOptions{})
+}
+
+func InferGitInfoWithOptions(skipCount int, options InferOptions) *GitInfo {
+	policy := options.BranchPolicy
+	runner := options.commandRunner()
+
 	access := Ok
 	branch := ""
 	commit := ""
 
-	if !isGitInstalled() {
-		access = NoGitCommandFound
-	} else if !hasGitRepository() {
+	var (
+		branchRule  BranchRule
+		candidates  []string
+		describe    string
+		detached    bool
+		details     *gitCommit
+		diffHash    string
+		history     GitHistory
+		modified    []string
+		nearestTag  string
+		remote      *GitRemote
+		tagDistance int
+		tags        []string
+		untracked   []string
+	)
+
+	if !isGitInstalled(runner) {
+		//
+		// Fall back to reading the repository directly:
+		//
+		repo, err := openGitRepository(".", options.environment())
+
+		if err == errNotGitRepository {
+			access = NotGitRepository
+		} else if err != nil {
+			access = NoGitCommandFound
+		} else {
+			defer repo.close()
+
+			commit, history = repo.inferCommit(skipCount)
+			branch, candidates, branchRule = repo.inferBranch(commit, policy)
+			detached = repo.isHeadDetached()
+
+			if len(commit) > 0 {
+				details, _ = repo.readCommit(commit)
+				tags = repo.tags(commit)
+				nearestTag, tagDistance = repo.describe(commit)
+				describe = formatGitDescription(nearestTag, tagDistance, abbreviateCommit(commit))
+			}
+
+			modified, untracked, _ = repo.status()
+			remote = repo.remote()
+		}
+	} else if !hasGitRepository(runner) {
 		access = NotGitRepository
 	} else {
-		commit = inferGitCommit(skipCount)
-		branch = inferGitBranch(commit)
+		commit, history = inferGitCommit(runner, skipCount)
+		branch, candidates, branchRule = inferGitBranch(runner, commit, policy)
+		detached = isGitHeadDetached(runner)
+		details = inferGitCommitDetails(runner, commit)
+		tags = inferGitTags(runner, commit)
+		nearestTag, tagDistance, describe = inferGitDescription(runner, commit)
+		modified, untracked = inferGitStatus(runner)
+		remote = inferGitRemote(runner)
+
+		if options.DiffHash && len(modified) > 0 {
+			diffHash = inferGitDiffHash(runner)
+		}
+	}
+
+	if details == nil {
+		details = &gitCommit{hash: commit}
 	}
 
 	return &GitInfo{
-		access: access,
-		branch: branch,
-		commit: commit}
+		access:      access,
+		branch:      branch,
+		branchRule:  branchRule,
+		candidates:  candidates,
+		commit:      commit,
+		describe:    describe,
+		detached:    detached,
+		details:     *details,
+		diffHash:    diffHash,
+		history:     history,
+		modified:    modified,
+		nearestTag:  nearestTag,
+		remote:      remote,
+		tagDistance: tagDistance,
+		tags:        tags,
+		untracked:   untracked}
 }
 
 //-----------------------------------------------------------------------------
@@ -58,86 +168,278 @@ func (gi *GitInfo) Access() GitAccess {
 	return gi.access
 }
 
+func (gi *GitInfo) AuthorDate() time.Time {
+	return gi.details.authorDate
+}
+
+func (gi *GitInfo) AuthorName() string {
+	return gi.details.authorName
+}
+
 func (gi *GitInfo) Branch() string {
 	return gi.branch
 }
 
+func (gi *GitInfo) BranchRule() BranchRule {
+	return gi.branchRule
+}
+
+func (gi *GitInfo) CandidateBranches() []string {
+	return gi.candidates
+}
+
 func (gi *GitInfo) Commit() string {
 	return gi.commit
 }
 
+func (gi *GitInfo) CommitBody() string {
+	_, body := splitCommitMessage(gi.details.message)
+
+	return body
+}
+
+func (gi *GitInfo) CommitSubject() string {
+	subject, _ := splitCommitMessage(gi.details.message)
+
+	return subject
+}
+
+func (gi *GitInfo) CommitterDate() time.Time {
+	return gi.details.committerDate
+}
+
+func (gi *GitInfo) CommitterName() string {
+	return gi.details.committerName
+}
+
+func (gi *GitInfo) Describe() string {
+	return gi.describe
+}
+
+// Returns the SHA-256 hash of the uncommitted changes (as output by `git diff
+// --binary HEAD`) if the working tree is dirty. Only computed when requested
+// through InferOptions.DiffHash.
+func (gi *GitInfo) DiffHash() string {
+	return gi.diffHash
+}
+
+func (gi *GitInfo) History() GitHistory {
+	return gi.history
+}
+
+func (gi *GitInfo) IsDetachedHead() bool {
+	return gi.detached
+}
+
+func (gi *GitInfo) IsDirty() bool {
+	return len(gi.modified) > 0 || len(gi.untracked) > 0
+}
+
+func (gi *GitInfo) IsMergeCommit() bool {
+	return len(gi.details.parents) > 1
+}
+
+func (gi *GitInfo) ModifiedFiles() []string {
+	return gi.modified
+}
+
+func (gi *GitInfo) NearestTag() string {
+	return gi.nearestTag
+}
+
+func (gi *GitInfo) Parents() []string {
+	return gi.details.parents
+}
+
+func (gi *GitInfo) Remote() *GitRemote {
+	return gi.remote
+}
+
+func (gi *GitInfo) TagDistance() int {
+	return gi.tagDistance
+}
+
+func (gi *GitInfo) Tags() []string {
+	return gi.tags
+}
+
+func (gi *GitInfo) UntrackedFiles() []string {
+	return gi.untracked
+}
+
 //-----------------------------------------------------------------------------
 
+func fallbackGitBranch(commit, fromFetchHead string, policy *BranchPolicy) (string, []string, BranchRule) {
+	if len(fromFetchHead) > 0 {
+		return fromFetchHead, nil, FetchHead
+	}
+
+	//
+	// As a last resort, trust the CI provider (if it is reporting on the same
+	// commit, or if we could not even determine the commit):
+	//
+	if policy != nil && len(policy.CIBranch) > 0 {
+		if len(commit) == 0 || len(policy.CICommit) == 0 || policy.CICommit == commit {
+			return policy.CIBranch, nil, CIProvided
+		}
+	}
+
+	return "", nil, NoBranchRule
+}
+
 func fetchBranchNamesFromGitForEachRefResults(results string) []string {
-	lines := strings.Split(results, "\n")
+	return branchCandidateNames(fetchBranchCandidatesFromGitForEachRefResults(results))
+}
+
+func fetchFilesFromGitStatusResults(results string) ([]string, []string) {
+	var modified, untracked []string
 
-	var branchNames []string
+	entries := strings.Split(results, "\x00")
 
-	for _, line := range lines {
-		branchName := refNameToBranchName(line)
+	for idx := 0; idx < len(entries); idx++ {
+		entry := entries[idx]
 
-		if len(branchName) > 0 {
-			branchNames = append(branchNames, branchName)
+		if len(entry) < 4 {
+			continue
+		}
+
+		status := entry[:2]
+		path := entry[3:]
+
+		switch {
+		case status == "??":
+			untracked = append(untracked, path)
+
+		case status == "!!":
+			break // ignored
+
+		default:
+			modified = append(modified, path)
+
+			if status[0] == 'R' || status[0] == 'C' {
+				idx++
+
+				if status[0] == 'R' && idx < len(entries) {
+					modified = append(modified, entries[idx]) // original path is gone
+				}
+			}
 		}
 	}
 
-	return removeDuplicates(branchNames)
+	return modified, untracked
 }
 
-func hasGitRepository() bool {
-	_, _, err := run("git", "rev-parse")
+func fetchHeadToBranchName(content, commit string) string {
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+
+		if len(fields) < 3 || fields[0] != commit {
+			continue
+		}
+
+		//
+		// For example: “branch 'feature/login' of https://github.com/acme/app”
+		//
+		description := fields[2]
+
+		if !strings.HasPrefix(description, "branch '") {
+			continue
+		}
+
+		description = strings.TrimPrefix(description, "branch '")
+
+		if quote := strings.Index(description, "'"); quote > 0 {
+			return description[:quote]
+		}
+	}
+
+	return ""
+}
+
+func hasGitRepository(runner CommandRunner) bool {
+	_, _, err := runner.Run("git", "rev-parse")
 
 	return err == nil
 }
 
-func inferGitBranch(commit string) string {
+func inferGitBranch(runner CommandRunner, commit string, policy *BranchPolicy) (string, []string, BranchRule) {
 	if len(commit) > 0 {
-		fromForEachRev := inferGitBranchFromForEachRef(commit)
+		candidates := inferGitBranchCandidatesFromForEachRef(runner, commit)
+
+		if len(candidates) > 0 {
+			defaultBranchName := ""
 
-		if len(fromForEachRev) > 0 {
-			return fromForEachRev
+			if policy.needsDefaultBranchName(len(candidates)) {
+				defaultBranchName = inferGitDefaultBranchName(runner)
+			}
+
+			branch, rule := selectBranch(candidates, policy, defaultBranchName)
+
+			return branch, branchCandidateNames(candidates), rule
 		}
 
-		fromNameRev := inferGitBranchFromNameRev(commit)
+		fromNameRev := inferGitBranchFromNameRev(runner, commit)
 
 		if len(fromNameRev) > 0 {
-			return fromNameRev
+			return fromNameRev, nil, NameRevMatch
 		}
 	}
 
-	return inferGitBranchFromRevParse()
+	fromRevParse := inferGitBranchFromRevParse(runner)
+
+	if len(fromRevParse) > 0 {
+		return fromRevParse, nil, CurrentHead
+	}
+
+	return fallbackGitBranch(commit, inferGitBranchFromFetchHead(runner, commit), policy)
 }
 
-func inferGitBranchFromForEachRef(commit string) string {
-	stdout, _, err := run("git", "for-each-ref", fmt.Sprintf("--points-at=%s", commit), "--format=%(refname)")
+func inferGitBranchCandidatesFromForEachRef(runner CommandRunner, commit string) []gitBranchCandidate {
+	stdout, _, err := runner.Run("git", "for-each-ref", fmt.Sprintf("--points-at=%s", commit), "--format=%(refname)")
+
+	if err != nil {
+		return nil
+	}
+
+	return fetchBranchCandidatesFromGitForEachRefResults(stdout)
+}
 
-	if err == nil {
-		branchNames := fetchBranchNamesFromGitForEachRefResults(stdout)
+func inferGitBranchFromFetchHead(runner CommandRunner, commit string) string {
+	path, _, err := runner.Run("git", "rev-parse", "--git-path", "FETCH_HEAD")
 
-		if len(branchNames) > 0 {
-			//
-			// Since we don’t know which branch is the correct one, arbitrarily
-			// return the first one:
-			//
-			return branchNames[0]
-		}
+	if err != nil {
+		return ""
 	}
 
-	return ""
+	content, err := os.ReadFile(path)
+
+	if err != nil {
+		return ""
+	}
+
+	return fetchHeadToBranchName(string(content), commit)
 }
 
-func inferGitBranchFromNameRev(commit string) string {
-	name, _, err := run("git", "name-rev", "--always", "--name-only", commit)
+func inferGitBranchFromNameRev(runner CommandRunner, commit string) string {
+	name, _, err := runner.Run("git", "name-rev", "--always", "--name-only", commit)
 
-	if err == nil {
-		return nameRevToBranchName(name)
+	if err != nil {
+		return ""
 	}
 
-	return ""
+	//
+	// With `--always`, an abbreviated commit hash is returned when no name
+	// can be found (which is likely in a shallow clone):
+	//
+	if strings.HasPrefix(commit, strings.TrimSpace(name)) {
+		return ""
+	}
+
+	return nameRevToBranchName(name)
 }
 
-func inferGitBranchFromRevParse() string {
-	name, _, err := run("git", "rev-parse", "--abbrev-ref", "HEAD")
+func inferGitBranchFromRevParse(runner CommandRunner) string {
+	name, _, err := runner.Run("git", "rev-parse", "--abbrev-ref", "HEAD")
 
 	if err == nil && name != "HEAD" {
 		return name
@@ -146,19 +448,132 @@ func inferGitBranchFromRevParse() string {
 	return ""
 }
 
-func inferGitCommit(skipCount int) string {
+func inferGitCommit(runner CommandRunner, skipCount int) (string, GitHistory) {
+	history := FullHistory
+
+	if isGitShallowRepository(runner) {
+		history = ShallowHistory
+	}
+
 	skip := fmt.Sprintf("--skip=%d", skipCount)
 
-	hash, _, err := run("git", "log", "--format=%H", skip, "-1")
+	hash, _, err := runner.Run("git", "log", "--format=%H", skip, "-1")
+
+	if err == nil && len(hash) > 0 {
+		return hash, history
+	}
+
+	if skipCount == 0 {
+		return "", history
+	}
+
+	//
+	// Not enough history was fetched to skip that many commits, but the
+	// parent hashes are still recorded in the commit itself:
+	//
+	head, _, err := runner.Run("git", "rev-parse", "HEAD")
+
+	if err != nil {
+		return "", history
+	}
+
+	details := inferGitCommitDetails(runner, head)
+
+	if details == nil {
+		return "", history
+	}
+
+	return skipToRecordedParent(details.parents, skipCount), MissingParents
+}
+
+func inferGitCommitDetails(runner CommandRunner, commit string) *gitCommit {
+	if len(commit) == 0 {
+		return nil
+	}
+
+	data, _, err := runner.Run("git", "cat-file", "commit", commit)
+
+	if err != nil {
+		return nil
+	}
+
+	return parseGitCommit(commit, []byte(data))
+}
+
+func inferGitDefaultBranchName(runner CommandRunner) string {
+	name, _, err := runner.Run("git", "symbolic-ref", "--quiet", "refs/remotes/origin/HEAD")
+
+	if err != nil {
+		return ""
+	}
+
+	return refNameToBranchName(name)
+}
+
+func inferGitDescription(runner CommandRunner, commit string) (string, int, string) {
+	if len(commit) == 0 {
+		return "", 0, ""
+	}
+
+	stdout, _, err := runner.Run("git", "describe", "--tags", "--long", commit)
 
 	if err != nil {
+		return "", 0, "" // no tags, or not enough history
+	}
+
+	tag, distance, abbrev := parseGitDescribeOutput(stdout)
+
+	return tag, distance, formatGitDescription(tag, distance, abbrev)
+}
+
+func inferGitDiffHash(runner CommandRunner) string {
+	hash := sha256.New()
+
+	if _, err := runStreaming(runner, hash, "git", "diff", "--binary", "HEAD"); err != nil {
 		return ""
 	}
 
-	return hash
+	empty := sha256.Sum256(nil)
+	sum := hash.Sum(nil)
+
+	if bytes.Equal(sum, empty[:]) {
+		return "" // no diff
+	}
+
+	return fmt.Sprintf("%x", sum)
 }
 
-func isGitInstalled() bool {
+func inferGitStatus(runner CommandRunner) ([]string, []string) {
+	stdout, _, err := runner.Run("git", "status", "--porcelain", "-z", "--untracked-files=all")
+
+	if err != nil {
+		return nil, nil
+	}
+
+	return fetchFilesFromGitStatusResults(stdout)
+}
+
+func inferGitTags(runner CommandRunner, commit string) []string {
+	if len(commit) == 0 {
+		return nil
+	}
+
+	stdout, _, err := runner.Run("git", "tag", "--points-at", commit)
+
+	if err != nil || len(stdout) == 0 {
+		return nil
+	}
+
+	return strings.Split(stdout, "\n")
+}
+
+func isGitHeadDetached(runner CommandRunner) bool {
+	_, _, err := runner.Run("git", "symbolic-ref", "--quiet", "HEAD")
+
+	return err != nil
+}
+
+func isGitInstalled(runner CommandRunner) bool {
 	var name string
 
 	if runtime.GOOS == "windows" {
@@ -167,18 +582,31 @@ func isGitInstalled() bool {
 		name = "git"
 	}
 
-	_, err := exec.LookPath(name)
+	_, err := runner.LookPath(name)
 
 	return err == nil
 }
 
+func isGitShallowRepository(runner CommandRunner) bool {
+	stdout, _, err := runner.Run("git", "rev-parse", "--is-shallow-repository")
+
+	return err == nil && stdout == "true"
+}
+
 func nameRevToBranchName(refName string) string {
 	branchName := strings.TrimSpace(refName)
 
-	if strings.HasPrefix(branchName, "tags/") {
+	if strings.HasPrefix(branchName, "tags/") || branchName == "undefined" {
 		return ""
 	}
 
+	//
+	// Remove any ancestry suffix (for example, `main~2` or `main^2`):
+	//
+	if suffix := strings.IndexAny(branchName, "~^"); suffix != -1 {
+		branchName = branchName[:suffix]
+	}
+
 	if strings.HasPrefix(branchName, "remotes/") {
 		branchName = strings.TrimPrefix(branchName, "remotes/")
 
@@ -230,17 +658,31 @@ func refNameToBranchName(refName string) string {
 	return branchName
 }
 
-func removeDuplicates(strings []string) []string {
-	seen := make(map[string]bool)
+func skipToRecordedParent(parents []string, skipCount int) string {
+	if skipCount != 1 || len(parents) == 0 {
+		return "" // cannot go any further back without the parent commits
+	}
 
-	var result []string
+	//
+	// A merge commit created by a CI provider for a pull request (the only
+	// reason to skip a commit) has the head of the pull request as its last
+	// parent:
+	//
+	return parents[len(parents)-1]
+}
 
-	for _, s := range strings {
-		if _, ok := seen[s]; !ok {
-			seen[s] = true
-			result = append(result, s)
-		}
+func splitCommitMessage(message string) (string, string) {
+	//
+	// Like `git log --format=%s`, the subject is the entire first paragraph
+	// joined into a single line:
+	//
+	paragraphs := strings.SplitN(strings.TrimSpace(message), "\n\n", 2)
+
+	subject := strings.Join(strings.Fields(paragraphs[0]), " ")
+
+	if len(paragraphs) < 2 {
+		return subject, ""
 	}
 
-	return result
+	return subject, strings.TrimSpace(paragraphs[1])
 }
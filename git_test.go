@@ -2,6 +2,7 @@ package waldo
 
 import (
 	"testing"
+	"time"
 )
 
 func TestFetchBranchesCanHaveMultiple(t *testing.T) {
@@ -149,3 +150,112 @@ func TestNameRevToBranchNameTags(t *testing.T) {
 		t.Errorf("Expected %s string, got %v", expected, name)
 	}
 }
+
+func TestParseGitCommitMerge(t *testing.T) {
+	data := "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+		"parent 1111111111111111111111111111111111111111\n" +
+		"parent 2222222222222222222222222222222222222222\n" +
+		"author Jane Doe <jane@example.com> 1649682000 +0200\n" +
+		"committer John Roe <john@example.com> 1649685600 -0430\n" +
+		"gpgsig -----BEGIN PGP SIGNATURE-----\n" +
+		" \n" +
+		" iQEzBAABCAAdFiEE\n" +
+		" -----END PGP SIGNATURE-----\n" +
+		"\n" +
+		"Merge branch 'feature'\n" +
+		"into main\n" +
+		"\n" +
+		"Some details.\n"
+
+	commit := parseGitCommit("3333333333333333333333333333333333333333", []byte(data))
+
+	if len(commit.parents) != 2 {
+		t.Errorf("Expected 2 parents, got %v", commit.parents)
+	}
+
+	if commit.authorName != "Jane Doe" {
+		t.Errorf("Expected Jane Doe, got %v", commit.authorName)
+	}
+
+	if commit.authorDate.Format(time.RFC3339) != "2022-04-11T15:00:00+02:00" {
+		t.Errorf("Expected 2022-04-11T15:00:00+02:00, got %v", commit.authorDate.Format(time.RFC3339))
+	}
+
+	if commit.committerName != "John Roe" {
+		t.Errorf("Expected John Roe, got %v", commit.committerName)
+	}
+
+	if commit.committerDate.Format(time.RFC3339) != "2022-04-11T09:30:00-04:30" {
+		t.Errorf("Expected 2022-04-11T09:30:00-04:30, got %v", commit.committerDate.Format(time.RFC3339))
+	}
+
+	subject, body := splitCommitMessage(commit.message)
+
+	if subject != "Merge branch 'feature' into main" {
+		t.Errorf("Expected joined subject, got %v", subject)
+	}
+
+	if body != "Some details." {
+		t.Errorf("Expected body, got %v", body)
+	}
+}
+
+func TestSplitCommitMessageSubjectOnly(t *testing.T) {
+	subject, body := splitCommitMessage("Fix the thing\n")
+
+	if subject != "Fix the thing" {
+		t.Errorf("Expected Fix the thing, got %v", subject)
+	}
+
+	if body != "" {
+		t.Errorf("Expected empty body, got %v", body)
+	}
+}
+
+func TestFetchHeadToBranchName(t *testing.T) {
+	content := "1111111111111111111111111111111111111111\t\tbranch 'feature/login' of https://github.com/acme/app\n" +
+		"2222222222222222222222222222222222222222\tnot-for-merge\tbranch 'main' of https://github.com/acme/app\n" +
+		"3333333333333333333333333333333333333333\t\ttag 'v1.0' of https://github.com/acme/app\n"
+
+	name := fetchHeadToBranchName(content, "1111111111111111111111111111111111111111")
+
+	if name != "feature/login" {
+		t.Errorf("Expected feature/login, got %v", name)
+	}
+
+	name = fetchHeadToBranchName(content, "3333333333333333333333333333333333333333")
+
+	if name != "" {
+		t.Errorf("Expected empty string, got %v", name)
+	}
+}
+
+func TestNameRevToBranchNameAncestry(t *testing.T) {
+	name := nameRevToBranchName("remotes/origin/main~2^2")
+	expected := "main"
+
+	if name != expected {
+		t.Errorf("Expected %s string, got %v", expected, name)
+	}
+}
+
+func TestNameRevToBranchNameUndefined(t *testing.T) {
+	name := nameRevToBranchName("undefined")
+	expected := ""
+
+	if name != expected {
+		t.Errorf("Expected %s string, got %v", expected, name)
+	}
+}
+
+func TestSkipToRecordedParent(t *testing.T) {
+	parents := []string{"1111111111111111111111111111111111111111", "2222222222222222222222222222222222222222"}
+
+	if parent := skipToRecordedParent(parents, 1); parent != parents[1] {
+		t.Errorf("Expected %s, got %v", parents[1], parent)
+	}
+
+	if parent := skipToRecordedParent(parents, 2); parent != "" {
+		t.Errorf("Expected empty string, got %v", parent)
+	}
+}
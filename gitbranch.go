@@ -0,0 +1,218 @@
+package waldo
+
+import (
+	"path"
+	"strings"
+)
+
+type BranchPolicy struct {
+	CIBranch          string                  // preferred if it points at the commit
+	CICommit          string                  // commit that CIBranch applies to, if known
+	DefaultBranch     DefaultBranchPreference // whether to prefer or avoid the default branch
+	DefaultBranchName string                  // inferred from `origin/HEAD` if empty
+	Patterns          []string                // preferred in order, e.g. `release/*`
+	PreferLocal       bool                    // prefer local branches over remote ones
+	PreferRemote      bool                    // prefer remote branches over local ones, unless PreferLocal
+}
+
+//-----------------------------------------------------------------------------
+
+func (bp *BranchPolicy) needsDefaultBranchName(candidateCount int) bool {
+	return bp != nil && candidateCount > 1 && bp.DefaultBranch != IgnoreDefaultBranch && len(bp.DefaultBranchName) == 0
+}
+
+//-----------------------------------------------------------------------------
+
+type BranchRule int
+
+const (
+	NoBranchRule BranchRule = iota // MUST be first
+	OnlyCandidate
+	CIBranchMatch
+	PatternMatch
+	DefaultBranchMatch
+	LocalBranchMatch
+	FirstCandidate
+	NameRevMatch
+	CurrentHead
+	FetchHead
+	CIProvided
+	RemoteBranchMatch // new rules MUST be appended to keep existing values stable
+)
+
+func (br BranchRule) String() string {
+	return [...]string{
+		"none",
+		"onlyCandidate",
+		"ciBranch",
+		"pattern",
+		"defaultBranch",
+		"localBranch",
+		"firstCandidate",
+		"nameRev",
+		"currentHead",
+		"fetchHead",
+		"ciProvided",
+		"remoteBranch"}[br]
+}
+
+//-----------------------------------------------------------------------------
+
+type DefaultBranchPreference int
+
+const (
+	IgnoreDefaultBranch DefaultBranchPreference = iota // MUST be first
+	PreferDefaultBranch
+	AvoidDefaultBranch
+)
+
+func (dbp DefaultBranchPreference) String() string {
+	return [...]string{
+		"ignore",
+		"prefer",
+		"avoid"}[dbp]
+}
+
+//-----------------------------------------------------------------------------
+
+type gitBranchCandidate struct {
+	local  bool
+	name   string
+	remote bool
+}
+
+//-----------------------------------------------------------------------------
+
+func branchCandidateNames(candidates []gitBranchCandidate) []string {
+	var names []string
+
+	for _, candidate := range candidates {
+		names = append(names, candidate.name)
+	}
+
+	return names
+}
+
+func defaultBranchPolicy() *BranchPolicy {
+	return &BranchPolicy{PreferLocal: true}
+}
+
+func fetchBranchCandidatesFromGitForEachRefResults(results string) []gitBranchCandidate {
+	var candidates []gitBranchCandidate
+
+	index := make(map[string]int)
+
+	for _, line := range strings.Split(results, "\n") {
+		branchName := refNameToBranchName(line)
+
+		if len(branchName) == 0 {
+			continue
+		}
+
+		local := strings.HasPrefix(strings.TrimSpace(line), "refs/heads/")
+
+		if idx, ok := index[branchName]; ok {
+			candidates[idx].local = candidates[idx].local || local
+			candidates[idx].remote = candidates[idx].remote || !local
+		} else {
+			index[branchName] = len(candidates)
+			candidates = append(candidates, gitBranchCandidate{local: local, name: branchName, remote: !local})
+		}
+	}
+
+	return candidates
+}
+
+func parseDefaultBranchPreference(value string) DefaultBranchPreference {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "prefer":
+		return PreferDefaultBranch
+
+	case "avoid":
+		return AvoidDefaultBranch
+
+	default:
+		return IgnoreDefaultBranch
+	}
+}
+
+// Each rule in turn narrows down the candidates to those that satisfy it
+// (unless none do); the rule that leaves a single candidate is the one that
+// chose the winner.
+func selectBranch(candidates []gitBranchCandidate, policy *BranchPolicy, defaultBranchName string) (string, BranchRule) {
+	switch len(candidates) {
+	case 0:
+		return "", NoBranchRule
+
+	case 1:
+		return candidates[0].name, OnlyCandidate
+	}
+
+	if policy == nil {
+		policy = defaultBranchPolicy()
+	}
+
+	if len(policy.DefaultBranchName) > 0 {
+		defaultBranchName = policy.DefaultBranchName
+	}
+
+	type rule struct {
+		kind    BranchRule
+		enabled bool
+		test    func(gitBranchCandidate) bool
+	}
+
+	rules := []rule{
+		{CIBranchMatch, len(policy.CIBranch) > 0, func(c gitBranchCandidate) bool {
+			return c.name == policy.CIBranch
+		}}}
+
+	for _, pattern := range policy.Patterns {
+		pattern := pattern
+
+		rules = append(rules, rule{PatternMatch, len(pattern) > 0, func(c gitBranchCandidate) bool {
+			matched, _ := path.Match(pattern, c.name)
+
+			return matched
+		}})
+	}
+
+	rules = append(rules,
+		rule{DefaultBranchMatch, policy.DefaultBranch != IgnoreDefaultBranch && len(defaultBranchName) > 0, func(c gitBranchCandidate) bool {
+			return (c.name == defaultBranchName) == (policy.DefaultBranch == PreferDefaultBranch)
+		}},
+		rule{LocalBranchMatch, policy.PreferLocal, func(c gitBranchCandidate) bool {
+			return c.local
+		}},
+		rule{RemoteBranchMatch, policy.PreferRemote && !policy.PreferLocal, func(c gitBranchCandidate) bool {
+			return c.remote
+		}})
+
+	for _, r := range rules {
+		if !r.enabled {
+			continue
+		}
+
+		var subset []gitBranchCandidate
+
+		for _, candidate := range candidates {
+			if r.test(candidate) {
+				subset = append(subset, candidate)
+			}
+		}
+
+		if len(subset) > 0 && len(subset) < len(candidates) {
+			candidates = subset
+
+			if len(candidates) == 1 {
+				return candidates[0].name, r.kind
+			}
+		}
+	}
+
+	//
+	// Since we still don’t know which branch is the correct one, arbitrarily
+	// return the first one:
+	//
+	return candidates[0].name, FirstCandidate
+}
@@ -0,0 +1,99 @@
+package waldo
+
+import (
+	"reflect"
+	"testing"
+)
+
+var releaseCandidates = []gitBranchCandidate{
+	{local: false, name: "main", remote: true},
+	{local: true, name: "feature/login"},
+	{local: false, name: "release/4.2", remote: true}}
+
+func TestFetchBranchCandidatesMergesLocalAndRemote(t *testing.T) {
+	candidates := fetchBranchCandidatesFromGitForEachRefResults("refs/heads/foo\nrefs/remotes/origin/bar\nrefs/remotes/origin/foo")
+
+	expected := []gitBranchCandidate{{local: true, name: "foo", remote: true}, {local: false, name: "bar", remote: true}}
+
+	if !reflect.DeepEqual(candidates, expected) {
+		t.Errorf("Expected %v, got %v", expected, candidates)
+	}
+}
+
+func TestSelectBranchAvoidDefault(t *testing.T) {
+	policy := &BranchPolicy{DefaultBranch: AvoidDefaultBranch}
+
+	branch, rule := selectBranch(releaseCandidates[:1], policy, "main")
+
+	if branch != "main" || rule != OnlyCandidate {
+		t.Errorf("Expected main by onlyCandidate, got %v by %v", branch, rule)
+	}
+
+	branch, rule = selectBranch([]gitBranchCandidate{releaseCandidates[0], releaseCandidates[2]}, policy, "main")
+
+	if branch != "release/4.2" || rule != DefaultBranchMatch {
+		t.Errorf("Expected release/4.2 by defaultBranch, got %v by %v", branch, rule)
+	}
+}
+
+func TestSelectBranchCIBranch(t *testing.T) {
+	policy := &BranchPolicy{CIBranch: "release/4.2", PreferLocal: true}
+
+	branch, rule := selectBranch(releaseCandidates, policy, "")
+
+	if branch != "release/4.2" || rule != CIBranchMatch {
+		t.Errorf("Expected release/4.2 by ciBranch, got %v by %v", branch, rule)
+	}
+}
+
+func TestSelectBranchFirstCandidate(t *testing.T) {
+	branch, rule := selectBranch(releaseCandidates, &BranchPolicy{}, "")
+
+	if branch != "main" || rule != FirstCandidate {
+		t.Errorf("Expected main by firstCandidate, got %v by %v", branch, rule)
+	}
+}
+
+func TestSelectBranchPattern(t *testing.T) {
+	policy := &BranchPolicy{Patterns: []string{"hotfix/*", "release/*"}, PreferLocal: true}
+
+	branch, rule := selectBranch(releaseCandidates, policy, "")
+
+	if branch != "release/4.2" || rule != PatternMatch {
+		t.Errorf("Expected release/4.2 by pattern, got %v by %v", branch, rule)
+	}
+}
+
+func TestSelectBranchPreferDefault(t *testing.T) {
+	policy := &BranchPolicy{DefaultBranch: PreferDefaultBranch, DefaultBranchName: "main"}
+
+	branch, rule := selectBranch(releaseCandidates, policy, "master")
+
+	if branch != "main" || rule != DefaultBranchMatch {
+		t.Errorf("Expected main by defaultBranch, got %v by %v", branch, rule)
+	}
+}
+
+func TestSelectBranchPreferLocal(t *testing.T) {
+	branch, rule := selectBranch(releaseCandidates, nil, "")
+
+	if branch != "feature/login" || rule != LocalBranchMatch {
+		t.Errorf("Expected feature/login by localBranch, got %v by %v", branch, rule)
+	}
+}
+
+func TestSelectBranchPreferRemote(t *testing.T) {
+	candidates := []gitBranchCandidate{releaseCandidates[1], releaseCandidates[2]}
+
+	branch, rule := selectBranch(candidates, &BranchPolicy{PreferRemote: true}, "")
+
+	if branch != "release/4.2" || rule != RemoteBranchMatch {
+		t.Errorf("Expected release/4.2 by remoteBranch, got %v by %v", branch, rule)
+	}
+
+	branch, rule = selectBranch(candidates, &BranchPolicy{PreferLocal: true, PreferRemote: true}, "")
+
+	if branch != "feature/login" || rule != LocalBranchMatch {
+		t.Errorf("Expected feature/login by localBranch, got %v by %v", branch, rule)
+	}
+}
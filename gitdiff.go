@@ -0,0 +1,266 @@
+package waldo
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type GitChange struct {
+	oldPath string
+	path    string
+	status  GitChangeStatus
+}
+
+type GitChangeSet struct {
+	base    string
+	changes []GitChange
+	commits []string
+	head    string
+	target  string
+}
+
+//-----------------------------------------------------------------------------
+
+type GitChangeStatus int
+
+const (
+	ChangeAdded GitChangeStatus = iota + 1 // MUST be first
+	ChangeCopied
+	ChangeDeleted
+	ChangeModified
+	ChangeRenamed
+	ChangeTypeChanged
+)
+
+func (gcs GitChangeStatus) String() string {
+	return [...]string{
+		"added",
+		"copied",
+		"deleted",
+		"modified",
+		"renamed",
+		"typeChanged"}[gcs-1]
+}
+
+//-----------------------------------------------------------------------------
+
+var ErrInsufficientGitHistory = errors.New("Not enough git history to compute changes")
+
+//-----------------------------------------------------------------------------
+
+// Computes the changes between the merge base of `head` and `target` (a branch
+// name or any other revision) and `head` itself. If `head` is empty, the
+// current commit is used. Returns ErrInsufficientGitHistory if the merge base
+// is not available, which is most likely in a shallow clone.
+func ComputeGitChanges(head, target string) (*GitChangeSet, error) {
+	return ComputeGitChangesWithOptions(head, target, InferOptions{})
+}
+
+func ComputeGitChangesWithOptions(head, target string, options InferOptions) (*GitChangeSet, error) {
+	runner := options.commandRunner()
+
+	if !isGitInstalled(runner) {
+		return nil, errors.New("No git command found")
+	}
+
+	if !hasGitRepository(runner) {
+		return nil, errors.New("Not a git repository")
+	}
+
+	if len(head) == 0 {
+		head = "HEAD"
+	}
+
+	headHash, _, err := runner.Run("git", "rev-parse", "--verify", "--quiet", head+"^{commit}")
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to resolve git revision ‘%s’", head)
+	}
+
+	targetHash := resolveGitTarget(runner, target)
+
+	if len(targetHash) == 0 {
+		if isGitShallowRepository(runner) {
+			return nil, ErrInsufficientGitHistory
+		}
+
+		return nil, fmt.Errorf("Unable to resolve git revision ‘%s’", target)
+	}
+
+	base, _, err := runner.Run("git", "merge-base", headHash, targetHash)
+
+	if err != nil || len(base) == 0 {
+		if isGitShallowRepository(runner) {
+			return nil, ErrInsufficientGitHistory
+		}
+
+		return nil, fmt.Errorf("No common ancestor between ‘%s’ and ‘%s’", head, target)
+	}
+
+	diff, _, err := runner.Run("git", "diff", "--name-status", "-z", "-M", base, headHash)
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to compute git changes, error: %v", err)
+	}
+
+	commits, _, err := runner.Run("git", "rev-list", base+".."+headHash)
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list git commits, error: %v", err)
+	}
+
+	return &GitChangeSet{
+		base:    base,
+		changes: fetchChangesFromGitDiffResults(diff),
+		commits: splitLines(commits),
+		head:    headHash,
+		target:  target}, nil
+}
+
+//-----------------------------------------------------------------------------
+
+func (gc GitChange) OldPath() string {
+	return gc.oldPath
+}
+
+func (gc GitChange) Path() string {
+	return gc.path
+}
+
+func (gc GitChange) Status() GitChangeStatus {
+	return gc.status
+}
+
+//-----------------------------------------------------------------------------
+
+func (gcs *GitChangeSet) Base() string {
+	return gcs.base
+}
+
+func (gcs *GitChangeSet) Changes() []GitChange {
+	return gcs.changes
+}
+
+func (gcs *GitChangeSet) Commits() []string {
+	return gcs.commits
+}
+
+func (gcs *GitChangeSet) Head() string {
+	return gcs.head
+}
+
+// Returns every path touched by the changes, including the original paths of
+// renamed files.
+func (gcs *GitChangeSet) Paths() []string {
+	var paths []string
+
+	for _, change := range gcs.changes {
+		if len(change.oldPath) > 0 {
+			paths = append(paths, change.oldPath)
+		}
+
+		paths = append(paths, change.path)
+	}
+
+	return paths
+}
+
+func (gcs *GitChangeSet) Target() string {
+	return gcs.target
+}
+
+//-----------------------------------------------------------------------------
+
+func fetchChangesFromGitDiffResults(results string) []GitChange {
+	var changes []GitChange
+
+	fields := strings.Split(results, "\x00")
+
+	for idx := 0; idx < len(fields); idx++ {
+		code := strings.TrimSpace(fields[idx])
+
+		if len(code) == 0 || idx+1 >= len(fields) {
+			continue
+		}
+
+		change := GitChange{status: parseGitChangeStatus(code[0])}
+
+		if change.status == ChangeRenamed || change.status == ChangeCopied {
+			if idx+2 >= len(fields) {
+				break
+			}
+
+			change.oldPath = fields[idx+1]
+			change.path = fields[idx+2]
+			idx += 2
+		} else {
+			change.path = fields[idx+1]
+			idx++
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes
+}
+
+func parseGitChangeStatus(code byte) GitChangeStatus {
+	switch code {
+	case 'A':
+		return ChangeAdded
+
+	case 'C':
+		return ChangeCopied
+
+	case 'D':
+		return ChangeDeleted
+
+	case 'R':
+		return ChangeRenamed
+
+	case 'T':
+		return ChangeTypeChanged
+
+	default:
+		return ChangeModified
+	}
+}
+
+func resolveGitTarget(runner CommandRunner, target string) string {
+	if len(target) == 0 {
+		return ""
+	}
+
+	//
+	// In CI, the target branch is rarely checked out locally, so prefer the
+	// remote-tracking branch:
+	//
+	candidates := []string{"refs/remotes/origin/" + target, target}
+
+	if strings.HasPrefix(target, "refs/") || strings.HasPrefix(target, "origin/") {
+		candidates = []string{target}
+	}
+
+	for _, candidate := range candidates {
+		hash, _, err := runner.Run("git", "rev-parse", "--verify", "--quiet", candidate+"^{commit}")
+
+		if err == nil && len(hash) > 0 {
+			return hash
+		}
+	}
+
+	return ""
+}
+
+func splitLines(value string) []string {
+	var lines []string
+
+	for _, line := range strings.Split(value, "\n") {
+		if line = strings.TrimSpace(line); len(line) > 0 {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
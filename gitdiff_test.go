@@ -0,0 +1,117 @@
+package waldo
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func chdirGitFixture(t *testing.T, dir string) {
+	cwd, _ := os.Getwd()
+
+	t.Cleanup(func() { os.Chdir(cwd) })
+
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestComputeGitChanges(t *testing.T) {
+	dir := gitFixture(t)
+
+	writeGitFixtureFile(t, dir, "keep.txt", "keep\n")
+	writeGitFixtureFile(t, dir, "remove.txt", "remove\n")
+	writeGitFixtureFile(t, dir, "rename.txt", "a file long enough to be detected as a rename\n")
+	runGitFixture(t, dir, "add", "-A")
+	runGitFixture(t, dir, "commit", "--quiet", "-m", "Initial")
+
+	base := runGitFixture(t, dir, "rev-parse", "HEAD")
+
+	runGitFixture(t, dir, "checkout", "--quiet", "-b", "feature")
+	writeGitFixtureFile(t, dir, "keep.txt", "changed\n")
+	writeGitFixtureFile(t, dir, "src/added.txt", "added\n")
+	runGitFixture(t, dir, "rm", "--quiet", "remove.txt")
+	runGitFixture(t, dir, "mv", "rename.txt", "renamed.txt")
+	runGitFixture(t, dir, "add", "-A")
+	runGitFixture(t, dir, "commit", "--quiet", "-m", "Feature 1")
+	commitGitFixture(t, dir, 1)
+
+	runGitFixture(t, dir, "checkout", "--quiet", "main")
+	writeGitFixtureFile(t, dir, "main.txt", "main only\n")
+	runGitFixture(t, dir, "add", "-A")
+	runGitFixture(t, dir, "commit", "--quiet", "-m", "Main")
+	runGitFixture(t, dir, "checkout", "--quiet", "feature")
+
+	chdirGitFixture(t, dir)
+
+	changeSet, err := ComputeGitChanges("", "main")
+
+	if err != nil {
+		t.Fatalf("Expected change set, got %v", err)
+	}
+
+	if changeSet.Base() != base {
+		t.Errorf("Expected base %s, got %s", base, changeSet.Base())
+	}
+
+	if len(changeSet.Commits()) != 2 {
+		t.Errorf("Expected 2 commits, got %v", changeSet.Commits())
+	}
+
+	expected := map[string]GitChangeStatus{
+		"file.txt":      ChangeAdded,
+		"keep.txt":      ChangeModified,
+		"remove.txt":    ChangeDeleted,
+		"renamed.txt":   ChangeRenamed,
+		"src/added.txt": ChangeAdded}
+
+	if len(changeSet.Changes()) != len(expected) {
+		t.Errorf("Expected %d changes, got %v", len(expected), changeSet.Changes())
+	}
+
+	for _, change := range changeSet.Changes() {
+		if status, found := expected[change.Path()]; !found || status != change.Status() {
+			t.Errorf("Unexpected change %v %s", change.Status(), change.Path())
+		}
+
+		if change.Status() == ChangeRenamed && change.OldPath() != "rename.txt" {
+			t.Errorf("Expected rename.txt, got %s", change.OldPath())
+		}
+	}
+
+	if len(changeSet.Paths()) != len(expected)+1 {
+		t.Errorf("Expected %d paths, got %v", len(expected)+1, changeSet.Paths())
+	}
+}
+
+func TestComputeGitChangesShallow(t *testing.T) {
+	dir, _ := shallowGitFixture(t)
+
+	chdirGitFixture(t, dir)
+
+	_, err := ComputeGitChanges("", "feature")
+
+	if !errors.Is(err, ErrInsufficientGitHistory) {
+		t.Errorf("Expected ErrInsufficientGitHistory, got %v", err)
+	}
+}
+
+func TestFetchChangesFromGitDiffResults(t *testing.T) {
+	changes := fetchChangesFromGitDiffResults("M\x00a.txt\x00R087\x00old.txt\x00new.txt\x00D\x00gone.txt\x00")
+
+	if len(changes) != 3 {
+		t.Fatalf("Expected 3 changes, got %v", changes)
+	}
+
+	if changes[0].Status() != ChangeModified || changes[0].Path() != "a.txt" {
+		t.Errorf("Expected modified a.txt, got %v %s", changes[0].Status(), changes[0].Path())
+	}
+
+	if changes[1].Status() != ChangeRenamed || changes[1].OldPath() != "old.txt" || changes[1].Path() != "new.txt" {
+		t.Errorf("Expected old.txt renamed to new.txt, got %v %s %s", changes[1].Status(), changes[1].OldPath(), changes[1].Path())
+	}
+
+	if changes[2].Status() != ChangeDeleted || changes[2].Path() != "gone.txt" {
+		t.Errorf("Expected deleted gone.txt, got %v %s", changes[2].Status(), changes[2].Path())
+	}
+}
@@ -0,0 +1,442 @@
+package waldo
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+type gitPack struct {
+	file    *os.File // kept open for the lifetime of the repository
+	hashes  []byte   // sorted, 20 bytes each
+	offsets []int64
+}
+
+type gitObjectReader func(hash string) (string, []byte, error)
+
+const (
+	gitObjCommit   = 1
+	gitObjTree     = 2
+	gitObjBlob     = 3
+	gitObjTag      = 4
+	gitObjOfsDelta = 6
+	gitObjRefDelta = 7
+)
+
+// Sizes read from a pack are not trusted beyond this limit, which is far larger
+// than any commit, tree or tag.
+const maxGitObjectSize = 1 << 30
+
+var errMalformedGitPack = errors.New("Malformed git pack")
+
+//-----------------------------------------------------------------------------
+
+func openGitPack(idxPath string) (*gitPack, error) {
+	data, err := os.ReadFile(idxPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	//
+	// Only version 2 pack indexes (the default since git 1.5.2) are
+	// supported:
+	//
+	if len(data) < 8+256*4 || !bytes.Equal(data[:8], []byte{0xff, 't', 'O', 'c', 0, 0, 0, 2}) {
+		return nil, fmt.Errorf("Unsupported git pack index at ‘%s’", idxPath)
+	}
+
+	count := int(binary.BigEndian.Uint32(data[8+255*4:]))
+
+	hashesStart := 8 + 256*4
+	offsetsStart := hashesStart + count*20 + count*4 // skip CRCs
+	largeStart := offsetsStart + count*4
+
+	if len(data) < largeStart {
+		return nil, errMalformedGitPack
+	}
+
+	offsets := make([]int64, count)
+
+	for idx := 0; idx < count; idx++ {
+		offset := binary.BigEndian.Uint32(data[offsetsStart+idx*4:])
+
+		if offset&0x80000000 != 0 {
+			large := largeStart + int(offset&0x7fffffff)*8
+
+			if len(data) < large+8 {
+				return nil, errMalformedGitPack
+			}
+
+			offsets[idx] = int64(binary.BigEndian.Uint64(data[large:]))
+		} else {
+			offsets[idx] = int64(offset)
+		}
+	}
+
+	file, err := os.Open(strings.TrimSuffix(idxPath, ".idx") + ".pack")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &gitPack{
+		file:    file,
+		hashes:  data[hashesStart : hashesStart+count*20],
+		offsets: offsets}, nil
+}
+
+//-----------------------------------------------------------------------------
+
+func (gp *gitPack) close() error {
+	return gp.file.Close()
+}
+
+func (gp *gitPack) find(hash string) (int64, bool) {
+	want, err := hex.DecodeString(hash)
+
+	if err != nil || len(want) != 20 {
+		return 0, false
+	}
+
+	count := len(gp.offsets)
+
+	idx := sort.Search(count, func(i int) bool {
+		return bytes.Compare(gp.hashes[i*20:i*20+20], want) >= 0
+	})
+
+	if idx < count && bytes.Equal(gp.hashes[idx*20:idx*20+20], want) {
+		return gp.offsets[idx], true
+	}
+
+	return 0, false
+}
+
+func (gp *gitPack) readObject(offset int64, readByHash gitObjectReader) (string, []byte, error) {
+	objType, data, err := gp.readObjectAt(offset, readByHash, 0)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	return gitObjectTypeName(objType), data, nil
+}
+
+func (gp *gitPack) readObjectAt(offset int64, readByHash gitObjectReader, depth int) (int, []byte, error) {
+	if depth > 50 {
+		return 0, nil, errMalformedGitPack // delta chain is too long
+	}
+
+	header := make([]byte, 32)
+
+	n, err := gp.file.ReadAt(header, offset)
+
+	if err != nil && err != io.EOF {
+		return 0, nil, err
+	}
+
+	header = header[:n]
+
+	if len(header) == 0 {
+		return 0, nil, errMalformedGitPack
+	}
+
+	pos := 0
+	objType := int(header[0]>>4) & 0x07
+	size := int64(header[0] & 0x0f)
+	shift := uint(4)
+
+	for header[pos]&0x80 != 0 {
+		pos++
+
+		if pos >= len(header) {
+			return 0, nil, errMalformedGitPack
+		}
+
+		if shift > 63 {
+			return 0, nil, errMalformedGitPack
+		}
+
+		size |= int64(header[pos]&0x7f) << shift
+		shift += 7
+	}
+
+	pos++
+
+	switch objType {
+	case gitObjCommit, gitObjTree, gitObjBlob, gitObjTag:
+		data, err := inflateGitPackData(gp.file, offset+int64(pos), size)
+
+		return objType, data, err
+
+	case gitObjOfsDelta:
+		if pos >= len(header) {
+			return 0, nil, errMalformedGitPack
+		}
+
+		baseDistance := int64(header[pos] & 0x7f)
+
+		for header[pos]&0x80 != 0 {
+			pos++
+
+			if pos >= len(header) {
+				return 0, nil, errMalformedGitPack
+			}
+
+			baseDistance = ((baseDistance + 1) << 7) | int64(header[pos]&0x7f)
+		}
+
+		pos++
+
+		baseType, base, err := gp.readObjectAt(offset-baseDistance, readByHash, depth+1)
+
+		if err != nil {
+			return 0, nil, err
+		}
+
+		delta, err := inflateGitPackData(gp.file, offset+int64(pos), size)
+
+		if err != nil {
+			return 0, nil, err
+		}
+
+		data, err := applyGitDelta(base, delta)
+
+		return baseType, data, err
+
+	case gitObjRefDelta:
+		if len(header) < pos+20 {
+			return 0, nil, errMalformedGitPack
+		}
+
+		baseHash := hex.EncodeToString(header[pos : pos+20])
+
+		pos += 20
+
+		var (
+			baseType int
+			base     []byte
+		)
+
+		if baseOffset, ok := gp.find(baseHash); ok {
+			baseType, base, err = gp.readObjectAt(baseOffset, readByHash, depth+1)
+		} else {
+			var baseTypeName string
+
+			baseTypeName, base, err = readByHash(baseHash)
+			baseType = gitObjectTypeCode(baseTypeName)
+		}
+
+		if err != nil {
+			return 0, nil, err
+		}
+
+		delta, err := inflateGitPackData(gp.file, offset+int64(pos), size)
+
+		if err != nil {
+			return 0, nil, err
+		}
+
+		data, err := applyGitDelta(base, delta)
+
+		return baseType, data, err
+
+	default:
+		return 0, nil, fmt.Errorf("Unsupported git pack object type: %d", objType)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func applyGitDelta(base, delta []byte) ([]byte, error) {
+	pos := 0
+
+	readSize := func() (int, error) {
+		size := 0
+		shift := uint(0)
+
+		for {
+			if pos >= len(delta) {
+				return 0, errMalformedGitPack
+			}
+
+			b := delta[pos]
+
+			pos++
+
+			if shift > 63 {
+				return 0, errMalformedGitPack
+			}
+
+			size |= int(b&0x7f) << shift
+			shift += 7
+
+			if b&0x80 == 0 {
+				return size, nil
+			}
+		}
+	}
+
+	baseSize, err := readSize()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if baseSize != len(base) {
+		return nil, errMalformedGitPack
+	}
+
+	resultSize, err := readSize()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if resultSize < 0 || resultSize > maxGitObjectSize {
+		return nil, errMalformedGitPack
+	}
+
+	//
+	// The result size comes from the delta itself, so let the result grow as
+	// it is built rather than allocating it up front:
+	//
+	var result []byte
+
+	for pos < len(delta) {
+		op := delta[pos]
+
+		pos++
+
+		if op&0x80 != 0 { // copy from base
+			copyOffset := 0
+			copySize := 0
+
+			for bit := uint(0); bit < 4; bit++ {
+				if op&(1<<bit) != 0 {
+					if pos >= len(delta) {
+						return nil, errMalformedGitPack
+					}
+
+					copyOffset |= int(delta[pos]) << (8 * bit)
+					pos++
+				}
+			}
+
+			for bit := uint(0); bit < 3; bit++ {
+				if op&(1<<(4+bit)) != 0 {
+					if pos >= len(delta) {
+						return nil, errMalformedGitPack
+					}
+
+					copySize |= int(delta[pos]) << (8 * bit)
+					pos++
+				}
+			}
+
+			if copySize == 0 {
+				copySize = 0x10000
+			}
+
+			if copyOffset+copySize > len(base) {
+				return nil, errMalformedGitPack
+			}
+
+			result = append(result, base[copyOffset:copyOffset+copySize]...)
+		} else if op != 0 { // insert from delta
+			if pos+int(op) > len(delta) {
+				return nil, errMalformedGitPack
+			}
+
+			result = append(result, delta[pos:pos+int(op)]...)
+			pos += int(op)
+		} else {
+			return nil, errMalformedGitPack
+		}
+
+		if len(result) > resultSize {
+			return nil, errMalformedGitPack
+		}
+	}
+
+	if len(result) != resultSize {
+		return nil, errMalformedGitPack
+	}
+
+	return result, nil
+}
+
+func gitObjectTypeCode(name string) int {
+	switch name {
+	case "commit":
+		return gitObjCommit
+
+	case "tree":
+		return gitObjTree
+
+	case "blob":
+		return gitObjBlob
+
+	case "tag":
+		return gitObjTag
+
+	default:
+		return 0
+	}
+}
+
+func gitObjectTypeName(code int) string {
+	switch code {
+	case gitObjCommit:
+		return "commit"
+
+	case gitObjTree:
+		return "tree"
+
+	case gitObjBlob:
+		return "blob"
+
+	case gitObjTag:
+		return "tag"
+
+	default:
+		return ""
+	}
+}
+
+func inflateGitPackData(file *os.File, offset, size int64) ([]byte, error) {
+	reader, err := zlib.NewReader(io.NewSectionReader(file, offset, 1<<62))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer reader.Close()
+
+	//
+	// The size comes from the pack itself, so do not trust it for the
+	// allocation:
+	//
+	if size < 0 || size > maxGitObjectSize {
+		return nil, errMalformedGitPack
+	}
+
+	data, err := io.ReadAll(io.LimitReader(reader, size))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) != size {
+		return nil, errMalformedGitPack
+	}
+
+	return data, nil
+}
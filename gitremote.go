@@ -0,0 +1,262 @@
+package waldo
+
+import (
+	"bufio"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type GitRemote struct {
+	host  string
+	name  string
+	owner string
+	repo  string
+	url   string // with any credentials removed
+}
+
+type gitRemoteURL struct {
+	name string
+	url  string
+}
+
+//-----------------------------------------------------------------------------
+
+func InferGitRemote() *GitRemote {
+	return InferGitRemoteWithOptions(InferOptions{})
+}
+
+func InferGitRemoteWithOptions(options InferOptions) *GitRemote {
+	runner := options.commandRunner()
+
+	if isGitInstalled(runner) {
+		if hasGitRepository(runner) {
+			return inferGitRemote(runner)
+		}
+
+		return nil
+	}
+
+	repo, err := openGitRepository(".", options.environment())
+
+	if err != nil {
+		return nil
+	}
+
+	defer repo.close()
+
+	return repo.remote()
+}
+
+//-----------------------------------------------------------------------------
+
+func (gr *GitRemote) Host() string {
+	if gr == nil {
+		return ""
+	}
+
+	return gr.host
+}
+
+func (gr *GitRemote) Identity() string {
+	if gr == nil || len(gr.host) == 0 || len(gr.repo) == 0 {
+		return ""
+	}
+
+	if len(gr.owner) == 0 {
+		return gr.host + "/" + gr.repo
+	}
+
+	return gr.host + "/" + gr.owner + "/" + gr.repo
+}
+
+func (gr *GitRemote) Name() string {
+	if gr == nil {
+		return ""
+	}
+
+	return gr.name
+}
+
+func (gr *GitRemote) Owner() string {
+	if gr == nil {
+		return ""
+	}
+
+	return gr.owner
+}
+
+func (gr *GitRemote) Repo() string {
+	if gr == nil {
+		return ""
+	}
+
+	return gr.repo
+}
+
+func (gr *GitRemote) URL() string {
+	if gr == nil {
+		return ""
+	}
+
+	return gr.url
+}
+
+//-----------------------------------------------------------------------------
+
+func (gr *gitRepository) remote() *GitRemote {
+	file, err := os.Open(filepath.Join(gr.commonDir, "config"))
+
+	if err != nil {
+		return nil
+	}
+
+	defer file.Close()
+
+	var (
+		remoteURLs []gitRemoteURL
+		section    string
+	)
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if len(line) == 0 || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			section = strings.Trim(line, "[]")
+
+			continue
+		}
+
+		if !strings.HasPrefix(section, `remote "`) {
+			continue
+		}
+
+		equals := strings.Index(line, "=")
+
+		if equals == -1 || strings.ToLower(strings.TrimSpace(line[:equals])) != "url" {
+			continue
+		}
+
+		remoteURLs = append(remoteURLs, gitRemoteURL{
+			name: strings.TrimSuffix(strings.TrimPrefix(section, `remote "`), `"`),
+			url:  strings.Trim(strings.TrimSpace(line[equals+1:]), `"`)})
+	}
+
+	return selectGitRemote(remoteURLs)
+}
+
+//-----------------------------------------------------------------------------
+
+func fetchRemoteURLsFromGitConfigResults(results string) []gitRemoteURL {
+	var remoteURLs []gitRemoteURL
+
+	for _, line := range strings.Split(results, "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), " ", 2)
+
+		if len(fields) != 2 || !strings.HasPrefix(fields[0], "remote.") || !strings.HasSuffix(fields[0], ".url") {
+			continue
+		}
+
+		remoteURLs = append(remoteURLs, gitRemoteURL{
+			name: strings.TrimSuffix(strings.TrimPrefix(fields[0], "remote."), ".url"),
+			url:  strings.TrimSpace(fields[1])})
+	}
+
+	return remoteURLs
+}
+
+func inferGitRemote(runner CommandRunner) *GitRemote {
+	stdout, _, err := runner.Run("git", "config", "--get-regexp", `^remote\..*\.url$`)
+
+	if err != nil {
+		return nil
+	}
+
+	return selectGitRemote(fetchRemoteURLsFromGitConfigResults(stdout))
+}
+
+func parseGitRemoteURL(name, rawURL string) *GitRemote {
+	rawURL = strings.TrimSpace(rawURL)
+
+	if len(rawURL) == 0 {
+		return nil
+	}
+
+	var host, path string
+
+	if strings.Contains(rawURL, "://") {
+		parsed, err := url.Parse(rawURL)
+
+		if err != nil {
+			return nil
+		}
+
+		parsed.User = nil // never let credentials leave the machine
+		parsed.RawQuery = ""
+
+		host = parsed.Hostname()
+		path = parsed.Path
+		rawURL = parsed.String()
+
+		if parsed.Scheme == "file" {
+			host = ""
+		}
+	} else if colon := strings.Index(rawURL, ":"); colon > 1 && !strings.Contains(rawURL[:colon], "/") {
+		//
+		// An scp-like address, for example, `git@github.com:owner/repo.git`:
+		//
+		host = rawURL[:colon]
+		path = rawURL[colon+1:]
+
+		if at := strings.LastIndex(host, "@"); at != -1 {
+			host = host[at+1:]
+		}
+
+		rawURL = host + ":" + path
+	}
+
+	remote := &GitRemote{
+		host: strings.ToLower(host),
+		name: name,
+		url:  rawURL}
+
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+
+	if len(remote.host) == 0 || len(path) == 0 {
+		return remote // most likely a local path
+	}
+
+	if slash := strings.LastIndex(path, "/"); slash != -1 {
+		remote.owner = path[:slash]
+		remote.repo = path[slash+1:]
+	} else {
+		remote.repo = path
+	}
+
+	return remote
+}
+
+func selectGitRemote(remoteURLs []gitRemoteURL) *GitRemote {
+	if len(remoteURLs) == 0 {
+		return nil
+	}
+
+	selected := remoteURLs[0]
+
+	for _, remoteURL := range remoteURLs {
+		if remoteURL.name == "origin" {
+			selected = remoteURL
+
+			break
+		}
+	}
+
+	return parseGitRemoteURL(selected.name, selected.url)
+}
@@ -0,0 +1,657 @@
+package waldo
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//
+// A minimal, read-only git repository reader that parses the `.git` directory
+// directly. It is used when the `git` command is not available (for example,
+// in slim Docker build images).
+//
+
+type gitRepository struct {
+	commonDir  string // shared by all worktrees: objects, refs, packed-refs
+	gitDir     string // per-worktree: HEAD and other pseudo-refs
+	objectDirs []string
+	packs      []*gitPack
+	workDir    string
+}
+
+type gitCommit struct {
+	authorDate    time.Time
+	authorName    string
+	committerDate time.Time
+	committerName string
+	hash          string
+	message       string
+	parents       []string
+}
+
+var (
+	errMissingGitParents = errors.New("Not enough commits in git history")
+	errNotGitRepository  = errors.New("Not a git repository")
+)
+
+//-----------------------------------------------------------------------------
+
+func openGitRepository(path string, env Environment) (*gitRepository, error) {
+	path, err := filepath.Abs(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if gitDir := env.Getenv("GIT_DIR"); len(gitDir) > 0 {
+		if !filepath.IsAbs(gitDir) {
+			gitDir = filepath.Join(path, gitDir)
+		}
+
+		return newGitRepository(gitDir, path)
+	}
+
+	for {
+		dotGit := filepath.Join(path, ".git")
+
+		if isDir(dotGit) {
+			return newGitRepository(dotGit, path)
+		}
+
+		if isRegular(dotGit) {
+			gitDir, err := readGitDirFile(dotGit)
+
+			if err != nil {
+				return nil, err
+			}
+
+			return newGitRepository(gitDir, path)
+		}
+
+		parent := filepath.Dir(path)
+
+		if parent == path {
+			return nil, errNotGitRepository
+		}
+
+		path = parent
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func (gr *gitRepository) allRefs() (map[string]string, error) {
+	refs, err := gr.readPackedRefs()
+
+	if err != nil {
+		return nil, err
+	}
+
+	refsDir := filepath.Join(gr.commonDir, "refs")
+
+	walker := func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(gr.commonDir, path)
+
+		if err != nil {
+			return err
+		}
+
+		name := filepath.ToSlash(rel)
+
+		if hash, err := gr.resolveRef(name); err == nil {
+			refs[name] = hash
+		}
+
+		return nil
+	}
+
+	if isDir(refsDir) {
+		if err := filepath.WalkDir(refsDir, walker); err != nil {
+			return nil, err
+		}
+	}
+
+	return refs, nil
+}
+
+func (gr *gitRepository) close() {
+	for _, pack := range gr.packs {
+		pack.close()
+	}
+
+	gr.packs = nil
+}
+
+func (gr *gitRepository) head() (string, string, error) {
+	content, err := os.ReadFile(filepath.Join(gr.gitDir, "HEAD"))
+
+	if err != nil {
+		return "", "", err
+	}
+
+	value := strings.TrimSpace(string(content))
+
+	if !strings.HasPrefix(value, "ref: ") {
+		return "", value, nil
+	}
+
+	refName := strings.TrimSpace(strings.TrimPrefix(value, "ref: "))
+
+	hash, err := gr.resolveRef(refName)
+
+	if err != nil {
+		return refName, "", err
+	}
+
+	return refName, hash, nil
+}
+
+func (gr *gitRepository) inferBranch(commit string, policy *BranchPolicy) (string, []string, BranchRule) {
+	if len(commit) > 0 {
+		refNames, err := gr.refNamesPointingAt(commit)
+
+		if err == nil {
+			candidates := fetchBranchCandidatesFromGitForEachRefResults(strings.Join(refNames, "\n"))
+
+			if len(candidates) > 0 {
+				defaultBranchName := ""
+
+				if policy.needsDefaultBranchName(len(candidates)) {
+					defaultBranchName = gr.inferDefaultBranchName()
+				}
+
+				branch, rule := selectBranch(candidates, policy, defaultBranchName)
+
+				return branch, branchCandidateNames(candidates), rule
+			}
+		}
+	}
+
+	refName, _, _ := gr.head()
+
+	if branch := refNameToBranchName(refName); len(branch) > 0 {
+		return branch, nil, CurrentHead
+	}
+
+	return fallbackGitBranch(commit, gr.inferBranchFromFetchHead(commit), policy)
+}
+
+func (gr *gitRepository) inferBranchFromFetchHead(commit string) string {
+	content, err := os.ReadFile(filepath.Join(gr.gitDir, "FETCH_HEAD"))
+
+	if err != nil {
+		return ""
+	}
+
+	return fetchHeadToBranchName(string(content), commit)
+}
+
+func (gr *gitRepository) inferCommit(skipCount int) (string, GitHistory) {
+	history := FullHistory
+
+	if gr.isShallow() {
+		history = ShallowHistory
+	}
+
+	_, head, err := gr.head()
+
+	if err != nil || len(head) == 0 {
+		return "", history
+	}
+
+	hash, err := gr.skipCommits(head, skipCount)
+
+	if err == nil {
+		return hash, history
+	}
+
+	if err != errMissingGitParents {
+		return "", history
+	}
+
+	//
+	// Not enough history was fetched to skip that many commits, but the
+	// parent hashes are still recorded in the commit itself:
+	//
+	commit, err := gr.readCommit(head)
+
+	if err != nil {
+		return "", history
+	}
+
+	return skipToRecordedParent(commit.parents, skipCount), MissingParents
+}
+
+func (gr *gitRepository) inferDefaultBranchName() string {
+	content, err := os.ReadFile(gr.refPath("refs/remotes/origin/HEAD"))
+
+	if err != nil {
+		return ""
+	}
+
+	value := strings.TrimSpace(string(content))
+
+	if !strings.HasPrefix(value, "ref: ") {
+		return ""
+	}
+
+	return refNameToBranchName(strings.TrimPrefix(value, "ref: "))
+}
+
+func (gr *gitRepository) isHeadDetached() bool {
+	refName, _, err := gr.head()
+
+	return err == nil && len(refName) == 0
+}
+
+func (gr *gitRepository) isShallow() bool {
+	return isRegular(filepath.Join(gr.commonDir, "shallow"))
+}
+
+func (gr *gitRepository) loadPacks() error {
+	if gr.packs != nil {
+		return nil
+	}
+
+	gr.packs = []*gitPack{}
+
+	for _, objectDir := range gr.objectDirs {
+		idxPaths, err := filepath.Glob(filepath.Join(objectDir, "pack", "*.idx"))
+
+		if err != nil {
+			return err
+		}
+
+		for _, idxPath := range idxPaths {
+			pack, err := openGitPack(idxPath)
+
+			if err != nil {
+				return err
+			}
+
+			gr.packs = append(gr.packs, pack)
+		}
+	}
+
+	return nil
+}
+
+func (gr *gitRepository) readCommit(hash string) (*gitCommit, error) {
+	objType, data, err := gr.readObject(hash)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if objType != "commit" {
+		return nil, fmt.Errorf("Object %s is a %s, not a commit", hash, objType)
+	}
+
+	return parseGitCommit(hash, data), nil
+}
+
+func (gr *gitRepository) readObject(hash string) (string, []byte, error) {
+	hash = strings.ToLower(hash)
+
+	if !isCommitHash(hash) {
+		return "", nil, fmt.Errorf("Invalid object name: %s", hash)
+	}
+
+	for _, objectDir := range gr.objectDirs {
+		path := filepath.Join(objectDir, hash[:2], hash[2:])
+
+		if isRegular(path) {
+			return readLooseGitObject(path)
+		}
+	}
+
+	if err := gr.loadPacks(); err != nil {
+		return "", nil, err
+	}
+
+	for _, pack := range gr.packs {
+		if offset, ok := pack.find(hash); ok {
+			return pack.readObject(offset, gr.readObject)
+		}
+	}
+
+	return "", nil, fmt.Errorf("Object not found: %s", hash)
+}
+
+func (gr *gitRepository) readPackedRefs() (map[string]string, error) {
+	refs := make(map[string]string)
+
+	file, err := os.Open(filepath.Join(gr.commonDir, "packed-refs"))
+
+	if os.IsNotExist(err) {
+		return refs, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if len(line) == 0 || line[0] == '#' || line[0] == '^' { // skip peeled tags
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 2)
+
+		if len(fields) == 2 {
+			refs[strings.TrimSpace(fields[1])] = fields[0]
+		}
+	}
+
+	return refs, scanner.Err()
+}
+
+func (gr *gitRepository) refNamesPointingAt(commit string) ([]string, error) {
+	refs, err := gr.allRefs()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var refNames []string
+
+	for name, hash := range refs {
+		if hash == commit {
+			refNames = append(refNames, name)
+		}
+	}
+
+	sort.Strings(refNames) // same order as `git for-each-ref`
+
+	return refNames, nil
+}
+
+func (gr *gitRepository) resolveRef(name string) (string, error) {
+	for depth := 0; depth < 10; depth++ {
+		content, err := os.ReadFile(gr.refPath(name))
+
+		if os.IsNotExist(err) {
+			refs, err := gr.readPackedRefs()
+
+			if err != nil {
+				return "", err
+			}
+
+			if hash, ok := refs[name]; ok {
+				return hash, nil
+			}
+
+			return "", fmt.Errorf("Unknown ref: %s", name)
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		value := strings.TrimSpace(string(content))
+
+		if !strings.HasPrefix(value, "ref: ") {
+			return value, nil
+		}
+
+		name = strings.TrimSpace(strings.TrimPrefix(value, "ref: "))
+	}
+
+	return "", fmt.Errorf("Too many levels of symbolic refs: %s", name)
+}
+
+func (gr *gitRepository) refPath(name string) string {
+	if strings.HasPrefix(name, "refs/") && !strings.HasPrefix(name, "refs/worktree/") && !strings.HasPrefix(name, "refs/bisect/") {
+		return filepath.Join(gr.commonDir, filepath.FromSlash(name))
+	}
+
+	return filepath.Join(gr.gitDir, filepath.FromSlash(name))
+}
+
+// Emulates `git log --format=%H --skip=<skipCount> -1` by walking the commit
+// graph from the given commit, newest committer date first.
+func (gr *gitRepository) skipCommits(hash string, skipCount int) (string, error) {
+	commit, err := gr.readCommit(hash)
+
+	if err != nil {
+		return "", err
+	}
+
+	pending := []*gitCommit{commit}
+	seen := map[string]bool{hash: true}
+
+	for len(pending) > 0 {
+		newest := 0
+
+		for idx, candidate := range pending {
+			if candidate.committerDate.After(pending[newest].committerDate) {
+				newest = idx
+			}
+		}
+
+		commit = pending[newest]
+		pending = append(pending[:newest], pending[newest+1:]...)
+
+		if skipCount == 0 {
+			return commit.hash, nil
+		}
+
+		skipCount--
+
+		for _, parent := range commit.parents {
+			if seen[parent] {
+				continue
+			}
+
+			seen[parent] = true
+
+			parentCommit, err := gr.readCommit(parent)
+
+			if err != nil {
+				return "", errMissingGitParents
+			}
+
+			pending = append(pending, parentCommit)
+		}
+	}
+
+	return "", errMissingGitParents
+}
+
+//-----------------------------------------------------------------------------
+
+func newGitRepository(gitDir, workDir string) (*gitRepository, error) {
+	if !isRegular(filepath.Join(gitDir, "HEAD")) {
+		return nil, errNotGitRepository
+	}
+
+	commonDir := gitDir
+
+	if content, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		commonDir = strings.TrimSpace(string(content))
+
+		if !filepath.IsAbs(commonDir) {
+			commonDir = filepath.Join(gitDir, commonDir)
+		}
+	}
+
+	objectDir := filepath.Join(commonDir, "objects")
+
+	return &gitRepository{
+		commonDir:  filepath.Clean(commonDir),
+		gitDir:     filepath.Clean(gitDir),
+		objectDirs: append([]string{objectDir}, readGitAlternates(objectDir)...),
+		workDir:    workDir}, nil
+}
+
+func parseGitCommit(hash string, data []byte) *gitCommit {
+	commit := &gitCommit{hash: hash}
+
+	headers := string(data)
+
+	if blank := strings.Index(headers, "\n\n"); blank != -1 {
+		commit.message = strings.TrimSpace(headers[blank+2:])
+		headers = headers[:blank]
+	}
+
+	for _, line := range strings.Split(headers, "\n") {
+		switch {
+		case strings.HasPrefix(line, "parent "):
+			commit.parents = append(commit.parents, strings.TrimPrefix(line, "parent "))
+
+		case strings.HasPrefix(line, "author "):
+			commit.authorName, commit.authorDate = parseGitSignature(strings.TrimPrefix(line, "author "))
+
+		case strings.HasPrefix(line, "committer "):
+			commit.committerName, commit.committerDate = parseGitSignature(strings.TrimPrefix(line, "committer "))
+		}
+	}
+
+	return commit
+}
+
+func parseGitSignature(signature string) (string, time.Time) {
+	name := signature
+	rest := ""
+
+	if lt := strings.Index(signature, " <"); lt != -1 {
+		name = signature[:lt]
+
+		if gt := strings.LastIndex(signature, ">"); gt > lt {
+			rest = signature[gt+1:]
+		}
+	}
+
+	fields := strings.Fields(rest)
+
+	if len(fields) == 0 {
+		return name, time.Time{}
+	}
+
+	seconds, err := strconv.ParseInt(fields[0], 10, 64)
+
+	if err != nil {
+		return name, time.Time{}
+	}
+
+	location := time.UTC
+
+	if len(fields) > 1 && len(fields[1]) == 5 {
+		hours, err1 := strconv.Atoi(fields[1][1:3])
+		minutes, err2 := strconv.Atoi(fields[1][3:5])
+
+		if err1 == nil && err2 == nil {
+			offset := hours*3600 + minutes*60
+
+			if fields[1][0] == '-' {
+				offset = -offset
+			}
+
+			location = time.FixedZone(fields[1], offset)
+		}
+	}
+
+	return name, time.Unix(seconds, 0).In(location)
+}
+
+func readGitAlternates(objectDir string) []string {
+	content, err := os.ReadFile(filepath.Join(objectDir, "info", "alternates"))
+
+	if err != nil {
+		return nil
+	}
+
+	var dirs []string
+
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		if !filepath.IsAbs(line) {
+			line = filepath.Join(objectDir, line)
+		}
+
+		dirs = append(dirs, line)
+	}
+
+	return dirs
+}
+
+func readGitDirFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+
+	if err != nil {
+		return "", err
+	}
+
+	value := strings.TrimSpace(string(content))
+
+	if !strings.HasPrefix(value, "gitdir: ") {
+		return "", errNotGitRepository
+	}
+
+	gitDir := strings.TrimSpace(strings.TrimPrefix(value, "gitdir: "))
+
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(filepath.Dir(path), gitDir)
+	}
+
+	return gitDir, nil
+}
+
+func readLooseGitObject(path string) (string, []byte, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	defer file.Close()
+
+	reader, err := zlib.NewReader(file)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	nul := bytes.IndexByte(data, 0)
+
+	if nul == -1 {
+		return "", nil, fmt.Errorf("Malformed git object at ‘%s’", path)
+	}
+
+	header := strings.SplitN(string(data[:nul]), " ", 2)
+
+	return header[0], data[nul+1:], nil
+}
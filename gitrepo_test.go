@@ -0,0 +1,359 @@
+package waldo
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func gitFixture(t *testing.T) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+
+	runGitFixture(t, dir, "init", "--quiet", "--initial-branch=main")
+
+	return dir
+}
+
+func commitGitFixture(t *testing.T, dir string, count int) {
+	for idx := 0; idx < count; idx++ {
+		path := filepath.Join(dir, "file.txt")
+
+		//
+		// Append to a growing file so that `git gc` produces deltas:
+		//
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fmt.Fprintf(file, "line %d: %s\n", idx, strings.Repeat("lorem ipsum ", 20))
+		file.Close()
+
+		runGitFixture(t, dir, "add", "file.txt")
+		runGitFixture(t, dir, "commit", "--quiet", "-m", fmt.Sprintf("Commit %d", idx))
+	}
+}
+
+func inferFixtureCommit(repo *gitRepository) string {
+	commit, _ := repo.inferCommit(0)
+
+	return commit
+}
+
+func runGitFixture(t *testing.T, dir string, args ...string) string {
+	return strings.TrimSpace(runGitFixtureRaw(t, dir, args...))
+}
+
+func runGitFixtureRaw(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", append([]string{"-c", "protocol.file.allow=always"}, args...)...)
+
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Fixture",
+		"GIT_AUTHOR_EMAIL=fixture@example.com",
+		"GIT_COMMITTER_NAME=Fixture",
+		"GIT_COMMITTER_EMAIL=fixture@example.com",
+		"GIT_CONFIG_GLOBAL=/dev/null",
+		"GIT_CONFIG_NOSYSTEM=1")
+
+	output, err := cmd.CombinedOutput()
+
+	if err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, output)
+	}
+
+	return string(output)
+}
+
+func checkGitFixture(t *testing.T, dir string, skipCount int) {
+	repo, err := openGitRepository(dir, MapEnvironment{})
+
+	if err != nil {
+		t.Fatalf("Expected repository, got %v", err)
+	}
+
+	expectedCommit := runGitFixture(t, dir, "log", "--format=%H", fmt.Sprintf("--skip=%d", skipCount), "-1")
+	commit, _ := repo.inferCommit(skipCount)
+
+	if commit != expectedCommit {
+		t.Errorf("Expected commit %s, got %s", expectedCommit, commit)
+	}
+
+	expectedBranch := runGitFixture(t, dir, "rev-parse", "--abbrev-ref", "HEAD")
+	branch, _, _ := repo.inferBranch(inferFixtureCommit(repo), nil)
+
+	if branch != expectedBranch {
+		t.Errorf("Expected branch %s, got %s", expectedBranch, branch)
+	}
+}
+
+func shallowGitFixture(t *testing.T) (string, string) {
+	origin := gitFixture(t)
+
+	commitGitFixture(t, origin, 2)
+
+	runGitFixture(t, origin, "checkout", "--quiet", "-b", "feature")
+	commitGitFixture(t, origin, 1)
+
+	head := runGitFixture(t, origin, "rev-parse", "HEAD")
+
+	runGitFixture(t, origin, "checkout", "--quiet", "main")
+	runGitFixture(t, origin, "merge", "--quiet", "--no-ff", "-m", "Merge feature", "feature")
+
+	dir := filepath.Join(t.TempDir(), "clone")
+
+	runGitFixture(t, origin, "clone", "--quiet", "--depth=1", "file://"+origin, dir)
+	runGitFixture(t, dir, "checkout", "--quiet", "--detach")
+
+	return dir, head
+}
+
+func TestApplyGitDeltaMalformed(t *testing.T) {
+	for _, delta := range []string{
+		"\x01\xcf\xcf\xe1\xcf0\u03cb",                // result size far too large
+		"\x01" + strings.Repeat("\xff", 10) + "\x01", // result size overflows
+		"\x01\x01\x02ab"} {                           // result larger than declared
+		if _, err := applyGitDelta([]byte("0"), []byte(delta)); err != errMalformedGitPack {
+			t.Errorf("Expected errMalformedGitPack for %q, got %v", delta, err)
+		}
+	}
+
+	if data, err := applyGitDelta([]byte("0"), []byte("\x01\x02\x90\x01\x01b")); err != nil || string(data) != "0b" {
+		t.Errorf("Expected 0b, got %q, %v", data, err)
+	}
+}
+
+func TestGitRepositoryDetachedHead(t *testing.T) {
+	dir := gitFixture(t)
+
+	commitGitFixture(t, dir, 3)
+
+	runGitFixture(t, dir, "checkout", "--quiet", "--detach", "HEAD~1")
+
+	repo, err := openGitRepository(dir, MapEnvironment{})
+
+	if err != nil {
+		t.Fatalf("Expected repository, got %v", err)
+	}
+
+	expected := runGitFixture(t, dir, "rev-parse", "HEAD")
+
+	if commit, _ := repo.inferCommit(0); commit != expected {
+		t.Errorf("Expected commit %s, got %s", expected, commit)
+	}
+
+	if branch, _, _ := repo.inferBranch(expected, nil); branch != "" {
+		t.Errorf("Expected empty branch, got %s", branch)
+	}
+}
+
+func TestGitRepositoryGitDirFromEnvironment(t *testing.T) {
+	dir := gitFixture(t)
+
+	commitGitFixture(t, dir, 2)
+
+	repo, err := openGitRepository(t.TempDir(), MapEnvironment{"GIT_DIR": filepath.Join(dir, ".git")})
+
+	if err != nil {
+		t.Fatalf("Expected repository, got %v", err)
+	}
+
+	if commit, expected := inferFixtureCommit(repo), runGitFixture(t, dir, "rev-parse", "HEAD"); commit != expected {
+		t.Errorf("Expected commit %s, got %s", expected, commit)
+	}
+}
+
+func TestGitRepositoryLooseObjects(t *testing.T) {
+	dir := gitFixture(t)
+
+	commitGitFixture(t, dir, 3)
+
+	checkGitFixture(t, dir, 0)
+	checkGitFixture(t, dir, 2)
+}
+
+func TestGitRepositoryNotRepository(t *testing.T) {
+	_, err := openGitRepository(t.TempDir(), MapEnvironment{})
+
+	if err != errNotGitRepository {
+		t.Errorf("Expected errNotGitRepository, got %v", err)
+	}
+}
+
+func TestGitRepositoryPackedObjects(t *testing.T) {
+	dir := gitFixture(t)
+
+	commitGitFixture(t, dir, 20)
+
+	runGitFixture(t, dir, "branch", "feature", "HEAD~3")
+	runGitFixture(t, dir, "gc", "--quiet", "--aggressive")
+
+	if !isRegular(filepath.Join(dir, ".git", "packed-refs")) {
+		t.Fatal("Expected packed-refs after gc")
+	}
+
+	checkGitFixture(t, dir, 0)
+	checkGitFixture(t, dir, 5)
+
+	repo, _ := openGitRepository(dir, MapEnvironment{})
+
+	defer repo.close()
+
+	objects := runGitFixture(t, dir, "cat-file", "--batch-all-objects", "--batch-check=%(objectname) %(objecttype)")
+
+	for _, line := range strings.Split(objects, "\n") {
+		fields := strings.Fields(line)
+
+		objType, data, err := repo.readObject(fields[0])
+
+		if err != nil {
+			t.Fatalf("Expected object %s, got %v", fields[0], err)
+		}
+
+		if objType != fields[1] {
+			t.Errorf("Expected %s for %s, got %s", fields[1], fields[0], objType)
+		}
+
+		cmd := exec.Command("git", "cat-file", fields[1], fields[0])
+
+		cmd.Dir = dir
+
+		expected, _ := cmd.Output()
+
+		if string(data) != string(expected) {
+			t.Errorf("Object %s differs from git cat-file output", fields[0])
+		}
+	}
+}
+
+func TestGitRepositoryShallow(t *testing.T) {
+	dir, head := shallowGitFixture(t)
+
+	repo, err := openGitRepository(dir, MapEnvironment{})
+
+	if err != nil {
+		t.Fatalf("Expected repository, got %v", err)
+	}
+
+	if _, history := repo.inferCommit(0); history != ShallowHistory {
+		t.Errorf("Expected shallow history, got %v", history)
+	}
+
+	commit, history := repo.inferCommit(1)
+
+	if commit != head || history != MissingParents {
+		t.Errorf("Expected %s with missing parents, got %s with %v", head, commit, history)
+	}
+
+	if !repo.isHeadDetached() {
+		t.Error("Expected detached HEAD")
+	}
+}
+
+func TestGitRepositorySubmodule(t *testing.T) {
+	sub := gitFixture(t)
+
+	commitGitFixture(t, sub, 2)
+
+	dir := gitFixture(t)
+
+	commitGitFixture(t, dir, 1)
+
+	runGitFixture(t, dir, "submodule", "--quiet", "add", sub, "sub")
+
+	subDir := filepath.Join(dir, "sub")
+
+	if !isRegular(filepath.Join(subDir, ".git")) {
+		t.Fatal("Expected .git file in submodule")
+	}
+
+	checkGitFixture(t, subDir, 1)
+}
+
+func TestGitRepositoryWorktree(t *testing.T) {
+	dir := gitFixture(t)
+
+	commitGitFixture(t, dir, 3)
+
+	worktree := filepath.Join(t.TempDir(), "worktree")
+
+	runGitFixture(t, dir, "worktree", "add", "--quiet", "-b", "feature/worktree", worktree, "HEAD~1")
+
+	checkGitFixture(t, worktree, 0)
+	checkGitFixture(t, worktree, 1)
+
+	repo, _ := openGitRepository(worktree, MapEnvironment{})
+
+	if branch, _, _ := repo.inferBranch(inferFixtureCommit(repo), nil); branch != "feature/worktree" {
+		t.Errorf("Expected feature/worktree, got %s", branch)
+	}
+}
+
+func TestInferGitInfoShallow(t *testing.T) {
+	dir, head := shallowGitFixture(t)
+
+	cwd, _ := os.Getwd()
+
+	defer os.Chdir(cwd)
+
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	gitInfo := InferGitInfoWithOptions(1, InferOptions{BranchPolicy: &BranchPolicy{CIBranch: "feature", CICommit: head}})
+
+	if gitInfo.Commit() != head || gitInfo.History() != MissingParents {
+		t.Errorf("Expected %s with missing parents, got %s with %v", head, gitInfo.Commit(), gitInfo.History())
+	}
+
+	if gitInfo.Branch() != "feature" || gitInfo.BranchRule() != CIProvided {
+		t.Errorf("Expected feature from CI, got %s by %v", gitInfo.Branch(), gitInfo.BranchRule())
+	}
+
+	if !gitInfo.IsDetachedHead() {
+		t.Error("Expected detached HEAD")
+	}
+}
+
+func TestInflateGitPackDataMalformed(t *testing.T) {
+	var buffer bytes.Buffer
+
+	writer := zlib.NewWriter(&buffer)
+
+	writer.Write([]byte("tree 0123456789abcdef"))
+	writer.Close()
+
+	path := filepath.Join(t.TempDir(), "objects.pack")
+
+	if err := os.WriteFile(path, buffer.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	if data, err := inflateGitPackData(file, 0, 21); err != nil || string(data) != "tree 0123456789abcdef" {
+		t.Errorf("Expected inflated data, got %q, %v", data, err)
+	}
+
+	for _, size := range []int64{-1, 1 << 40} {
+		if _, err := inflateGitPackData(file, 0, size); err != errMalformedGitPack {
+			t.Errorf("Expected errMalformedGitPack for size %d, got %v", size, err)
+		}
+	}
+}
@@ -0,0 +1,586 @@
+package waldo
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type gitIndexEntry struct {
+	hash     string
+	mode     uint32
+	mtime    int64 // seconds
+	name     string
+	size     uint32
+	skipWork bool // assume-unchanged or skip-worktree
+	stage    int
+}
+
+type gitIgnore struct {
+	patterns []*gitIgnorePattern
+}
+
+type gitIgnorePattern struct {
+	anchored bool
+	baseDir  string // relative to the working tree, slash-separated
+	dirOnly  bool
+	negate   bool
+	regex    *regexp.Regexp
+}
+
+const (
+	gitModeGitlink = 0160000
+	gitModeMask    = 0170000
+	gitModeSymlink = 0120000
+)
+
+var errMalformedGitIndex = errors.New("Malformed git index")
+
+//-----------------------------------------------------------------------------
+
+func (gr *gitRepository) isWorkFileModified(entry *gitIndexEntry) bool {
+	if entry.skipWork || entry.mode&gitModeMask == gitModeGitlink {
+		return false
+	}
+
+	workPath := filepath.Join(gr.workDir, filepath.FromSlash(entry.name))
+
+	fi, err := os.Lstat(workPath)
+
+	if err != nil {
+		return true // deleted
+	}
+
+	var content []byte
+
+	if entry.mode&gitModeMask == gitModeSymlink {
+		target, err := os.Readlink(workPath)
+
+		if err != nil {
+			return true
+		}
+
+		content = []byte(target)
+	} else {
+		if !fi.Mode().IsRegular() {
+			return true
+		}
+
+		if uint32(fi.Size()) != entry.size {
+			return true
+		}
+
+		if fi.ModTime().Unix() == entry.mtime {
+			return false // racy, but this is what git assumes too
+		}
+
+		if content, err = os.ReadFile(workPath); err != nil {
+			return true
+		}
+	}
+
+	return gitBlobHash(content) != entry.hash
+}
+
+func (gr *gitRepository) readCommitFiles(commitHash string) (map[string]string, error) {
+	_, data, err := gr.readObject(commitHash)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(data, []byte("tree ")) || len(data) < 45 {
+		return nil, fmt.Errorf("Malformed commit: %s", commitHash)
+	}
+
+	files := make(map[string]string)
+
+	err = gr.readTreeFiles(string(data[5:45]), "", files)
+
+	return files, err
+}
+
+func (gr *gitRepository) readIndex() ([]*gitIndexEntry, error) {
+	data, err := os.ReadFile(filepath.Join(gr.gitDir, "index"))
+
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return parseGitIndex(data)
+}
+
+func (gr *gitRepository) readTreeFiles(treeHash, prefix string, files map[string]string) error {
+	objType, data, err := gr.readObject(treeHash)
+
+	if err != nil {
+		return err
+	}
+
+	if objType != "tree" {
+		return fmt.Errorf("Object %s is a %s, not a tree", treeHash, objType)
+	}
+
+	for len(data) > 0 {
+		space := bytes.IndexByte(data, ' ')
+		nul := bytes.IndexByte(data, 0)
+
+		if space == -1 || nul < space || len(data) < nul+21 {
+			return fmt.Errorf("Malformed tree: %s", treeHash)
+		}
+
+		mode := string(data[:space])
+		name := prefix + string(data[space+1:nul])
+		hash := hex.EncodeToString(data[nul+1 : nul+21])
+
+		data = data[nul+21:]
+
+		if mode == "40000" {
+			if err := gr.readTreeFiles(hash, name+"/", files); err != nil {
+				return err
+			}
+		} else {
+			files[name] = hash
+		}
+	}
+
+	return nil
+}
+
+// Emulates `git status --porcelain --untracked-files=all` closely enough to
+// tell whether the working tree is dirty, without needing the `git` command.
+// Only the `.gitignore` files in the working tree and `info/exclude` are
+// honored.
+func (gr *gitRepository) status() ([]string, []string, error) {
+	entries, err := gr.readIndex()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	modified := make(map[string]bool)
+	tracked := make(map[string]*gitIndexEntry)
+
+	for _, entry := range entries {
+		if entry.stage != 0 {
+			modified[entry.name] = true // unmerged
+		}
+
+		tracked[entry.name] = entry
+	}
+
+	//
+	// Staged changes (HEAD versus index):
+	//
+	if _, head, err := gr.head(); err == nil && len(head) > 0 {
+		headFiles, err := gr.readCommitFiles(head)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for name, hash := range headFiles {
+			if entry, ok := tracked[name]; !ok || entry.hash != hash {
+				modified[name] = true
+			}
+		}
+
+		for name := range tracked {
+			if _, ok := headFiles[name]; !ok {
+				modified[name] = true
+			}
+		}
+	} else {
+		for name := range tracked {
+			modified[name] = true // no commits yet
+		}
+	}
+
+	//
+	// Unstaged changes (index versus working tree):
+	//
+	for name, entry := range tracked {
+		if !modified[name] && gr.isWorkFileModified(entry) {
+			modified[name] = true
+		}
+	}
+
+	untracked, err := gr.untrackedFiles(tracked)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return sortedKeys(modified), untracked, nil
+}
+
+func (gr *gitRepository) untrackedFiles(tracked map[string]*gitIndexEntry) ([]string, error) {
+	ignore := &gitIgnore{}
+
+	ignore.load(filepath.Join(gr.commonDir, "info", "exclude"), "")
+
+	var untracked []string
+
+	walker := func(walkPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // unreadable, so skip it
+		}
+
+		rel, err := filepath.Rel(gr.workDir, walkPath)
+
+		if err != nil {
+			return err
+		}
+
+		rel = filepath.ToSlash(rel)
+
+		if entry.IsDir() {
+			if rel == "." {
+				ignore.load(filepath.Join(walkPath, ".gitignore"), "")
+
+				return nil
+			}
+
+			if entry.Name() == ".git" || ignore.matches(rel, true) {
+				return filepath.SkipDir
+			}
+
+			if _, ok := tracked[rel]; ok {
+				return filepath.SkipDir // submodule
+			}
+
+			if isNestedGitRepository(walkPath) {
+				return filepath.SkipDir
+			}
+
+			ignore.load(filepath.Join(walkPath, ".gitignore"), rel)
+
+			return nil
+		}
+
+		if _, ok := tracked[rel]; ok {
+			return nil
+		}
+
+		if !ignore.matches(rel, false) {
+			untracked = append(untracked, rel)
+		}
+
+		return nil
+	}
+
+	if err := filepath.WalkDir(gr.workDir, walker); err != nil {
+		return nil, err
+	}
+
+	sort.Strings(untracked)
+
+	return untracked, nil
+}
+
+//-----------------------------------------------------------------------------
+
+func (gi *gitIgnore) load(ignorePath, baseDir string) {
+	content, err := os.ReadFile(ignorePath)
+
+	if err != nil {
+		return
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		if pattern := parseGitIgnorePattern(line, baseDir); pattern != nil {
+			gi.patterns = append(gi.patterns, pattern)
+		}
+	}
+}
+
+func (gi *gitIgnore) matches(relPath string, isDir bool) bool {
+	ignored := false
+
+	for _, pattern := range gi.patterns {
+		if pattern.dirOnly && !isDir {
+			continue
+		}
+
+		subject := relPath
+
+		if len(pattern.baseDir) > 0 {
+			if !strings.HasPrefix(relPath, pattern.baseDir+"/") {
+				continue
+			}
+
+			subject = strings.TrimPrefix(relPath, pattern.baseDir+"/")
+		}
+
+		if !pattern.anchored {
+			subject = path.Base(subject)
+		}
+
+		if pattern.regex.MatchString(subject) {
+			ignored = !pattern.negate
+		}
+	}
+
+	return ignored
+}
+
+//-----------------------------------------------------------------------------
+
+func gitBlobHash(content []byte) string {
+	hash := sha1.New()
+
+	fmt.Fprintf(hash, "blob %d\x00", len(content))
+	hash.Write(content)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func gitGlobToRegexp(glob string) string {
+	var sb strings.Builder
+
+	sb.WriteString("^")
+
+	for idx := 0; idx < len(glob); idx++ {
+		ch := glob[idx]
+
+		switch {
+		case strings.HasPrefix(glob[idx:], "**/"):
+			sb.WriteString("(.*/)?")
+			idx += 2
+
+		case strings.HasPrefix(glob[idx:], "/**") && idx+3 == len(glob):
+			sb.WriteString("/.*")
+			idx += 2
+
+		case ch == '*':
+			sb.WriteString("[^/]*")
+
+		case ch == '?':
+			sb.WriteString("[^/]")
+
+		case ch == '[':
+			end := strings.IndexByte(glob[idx+1:], ']')
+
+			if end == -1 {
+				sb.WriteString(`\[`)
+			} else {
+				class := glob[idx+1 : idx+1+end]
+
+				if strings.HasPrefix(class, "!") {
+					class = "^" + class[1:]
+				}
+
+				sb.WriteString("[" + class + "]")
+				idx += end + 1
+			}
+
+		case ch == '\\' && idx+1 < len(glob):
+			idx++
+			sb.WriteString(regexp.QuoteMeta(string(glob[idx])))
+
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+
+	sb.WriteString("$")
+
+	return sb.String()
+}
+
+func isNestedGitRepository(dirPath string) bool {
+	dotGit := filepath.Join(dirPath, ".git")
+
+	return isDir(dotGit) || isRegular(dotGit)
+}
+
+func parseGitIgnorePattern(line, baseDir string) *gitIgnorePattern {
+	line = strings.TrimRight(line, "\r")
+
+	if !strings.HasSuffix(line, `\ `) {
+		line = strings.TrimRight(line, " ")
+	}
+
+	if len(line) == 0 || line[0] == '#' {
+		return nil
+	}
+
+	pattern := &gitIgnorePattern{baseDir: baseDir}
+
+	if line[0] == '!' {
+		pattern.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		pattern.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+
+	if strings.Contains(line, "/") {
+		pattern.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+
+	if len(line) == 0 {
+		return nil
+	}
+
+	regex, err := regexp.Compile(gitGlobToRegexp(line))
+
+	if err != nil {
+		return nil
+	}
+
+	pattern.regex = regex
+
+	return pattern
+}
+
+func parseGitIndex(data []byte) ([]*gitIndexEntry, error) {
+	if len(data) < 12 || string(data[:4]) != "DIRC" {
+		return nil, errMalformedGitIndex
+	}
+
+	version := binary.BigEndian.Uint32(data[4:8])
+	count := int(binary.BigEndian.Uint32(data[8:12]))
+
+	if version < 2 || version > 4 {
+		return nil, fmt.Errorf("Unsupported git index version: %d", version)
+	}
+
+	//
+	// Every entry takes at least 62 bytes, so a larger count cannot be
+	// trusted for the allocation:
+	//
+	if count > (len(data)-12)/62 {
+		return nil, errMalformedGitIndex
+	}
+
+	entries := make([]*gitIndexEntry, 0, count)
+	pos := 12
+	prevName := ""
+
+	for idx := 0; idx < count; idx++ {
+		start := pos
+
+		if len(data) < pos+62 {
+			return nil, errMalformedGitIndex
+		}
+
+		flags := binary.BigEndian.Uint16(data[pos+60:])
+
+		entry := &gitIndexEntry{
+			hash:     hex.EncodeToString(data[pos+40 : pos+60]),
+			mode:     binary.BigEndian.Uint32(data[pos+24:]),
+			mtime:    int64(binary.BigEndian.Uint32(data[pos+8:])),
+			size:     binary.BigEndian.Uint32(data[pos+36:]),
+			skipWork: flags&0x8000 != 0,
+			stage:    int(flags>>12) & 0x03}
+
+		pos += 62
+
+		if version >= 3 && flags&0x4000 != 0 {
+			if len(data) < pos+2 {
+				return nil, errMalformedGitIndex
+			}
+
+			extended := binary.BigEndian.Uint16(data[pos:])
+
+			entry.skipWork = entry.skipWork || extended&0x4000 != 0
+			pos += 2
+		}
+
+		if version == 4 {
+			//
+			// Path names are prefix-compressed against the previous entry:
+			//
+			strip, n := readGitIndexVarint(data[pos:])
+
+			if n == 0 || strip > len(prevName) {
+				return nil, errMalformedGitIndex
+			}
+
+			pos += n
+
+			nul := bytes.IndexByte(data[pos:], 0)
+
+			if nul == -1 {
+				return nil, errMalformedGitIndex
+			}
+
+			entry.name = prevName[:len(prevName)-strip] + string(data[pos:pos+nul])
+			pos += nul + 1
+		} else {
+			nul := bytes.IndexByte(data[pos:], 0)
+
+			if nul == -1 {
+				return nil, errMalformedGitIndex
+			}
+
+			entry.name = string(data[pos : pos+nul])
+			pos += nul + 1
+
+			//
+			// Entries are NUL-padded to a multiple of eight bytes:
+			//
+			for (pos-start)%8 != 0 {
+				pos++
+			}
+		}
+
+		prevName = entry.name
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func readGitIndexVarint(data []byte) (int, int) {
+	if len(data) == 0 {
+		return 0, 0
+	}
+
+	pos := 0
+	value := int(data[pos] & 0x7f)
+
+	for data[pos]&0x80 != 0 {
+		pos++
+
+		if pos >= len(data) {
+			return 0, 0
+		}
+
+		value = ((value + 1) << 7) | int(data[pos]&0x7f)
+	}
+
+	return value, pos + 1
+}
+
+func sortedKeys(set map[string]bool) []string {
+	var keys []string
+
+	for key := range set {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,152 @@
+package waldo
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// Hides the streaming support of the runner it wraps.
+type bufferedCommandRunner struct {
+	CommandRunner
+}
+
+func checkGitStatusFixture(t *testing.T, dir string) ([]string, []string) {
+	repo, err := openGitRepository(dir, MapEnvironment{})
+
+	if err != nil {
+		t.Fatalf("Expected repository, got %v", err)
+	}
+
+	modified, untracked, err := repo.status()
+
+	if err != nil {
+		t.Fatalf("Expected status, got %v", err)
+	}
+
+	expectedModified, expectedUntracked := fetchFilesFromGitStatusResults(runGitFixtureRaw(t, dir, "status", "--porcelain", "-z", "--untracked-files=all"))
+
+	sort.Strings(expectedModified)
+
+	if !reflect.DeepEqual(modified, expectedModified) {
+		t.Errorf("Expected modified %v, got %v", expectedModified, modified)
+	}
+
+	if !reflect.DeepEqual(untracked, expectedUntracked) {
+		t.Errorf("Expected untracked %v, got %v", expectedUntracked, untracked)
+	}
+
+	return modified, untracked
+}
+
+func writeGitFixtureFile(t *testing.T, dir, name, content string) {
+	path := filepath.Join(dir, filepath.FromSlash(name))
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGitStatusClean(t *testing.T) {
+	dir := gitFixture(t)
+
+	writeGitFixtureFile(t, dir, ".gitignore", "build/\n*.log\n!keep.log\n/root-only.txt\n")
+	writeGitFixtureFile(t, dir, "src/main.go", "package main\n")
+
+	runGitFixture(t, dir, "add", ".")
+	runGitFixture(t, dir, "commit", "--quiet", "-m", "Initial")
+
+	writeGitFixtureFile(t, dir, "build/output.bin", "ignored")
+	writeGitFixtureFile(t, dir, "debug.log", "ignored")
+	writeGitFixtureFile(t, dir, "root-only.txt", "ignored")
+
+	modified, untracked := checkGitStatusFixture(t, dir)
+
+	if len(modified) != 0 || len(untracked) != 0 {
+		t.Errorf("Expected clean tree, got %v and %v", modified, untracked)
+	}
+}
+
+func TestGitStatusDirty(t *testing.T) {
+	dir := gitFixture(t)
+
+	writeGitFixtureFile(t, dir, ".gitignore", "build/\n*.log\n!keep.log\n/root-only.txt\n")
+	writeGitFixtureFile(t, dir, "src/main.go", "package main\n")
+	writeGitFixtureFile(t, dir, "src/util.go", "package main\n")
+	writeGitFixtureFile(t, dir, "README.md", "# Fixture\n")
+
+	runGitFixture(t, dir, "add", ".")
+	runGitFixture(t, dir, "commit", "--quiet", "-m", "Initial")
+
+	writeGitFixtureFile(t, dir, "src/main.go", "package main\n\nfunc main() {}\n")
+	writeGitFixtureFile(t, dir, "src/staged.go", "package main\n")
+	writeGitFixtureFile(t, dir, "keep.log", "not ignored")
+	writeGitFixtureFile(t, dir, "nested/root-only.txt", "not ignored")
+	writeGitFixtureFile(t, dir, "nested/build/output.bin", "ignored")
+
+	runGitFixture(t, dir, "add", "src/staged.go")
+	runGitFixture(t, dir, "rm", "--quiet", "src/util.go")
+
+	os.Remove(filepath.Join(dir, "README.md"))
+
+	modified, untracked := checkGitStatusFixture(t, dir)
+
+	if len(modified) != 4 {
+		t.Errorf("Expected 4 modified files, got %v", modified)
+	}
+
+	if len(untracked) != 2 {
+		t.Errorf("Expected 2 untracked files, got %v", untracked)
+	}
+}
+
+func TestGitDiffHash(t *testing.T) {
+	dir := gitFixture(t)
+
+	writeGitFixtureFile(t, dir, "src/main.go", "package main\n")
+	runGitFixture(t, dir, "add", ".")
+	runGitFixture(t, dir, "commit", "--quiet", "-m", "Initial")
+	writeGitFixtureFile(t, dir, "src/main.go", "package main\n\nfunc main() {}\n")
+
+	expected := fmt.Sprintf("%x", sha256.Sum256([]byte(runGitFixtureRaw(t, dir, "diff", "--binary", "HEAD"))))
+
+	chdirGitFixture(t, dir)
+
+	if hash := InferGitInfoWithOptions(0, InferOptions{}).DiffHash(); len(hash) > 0 {
+		t.Errorf("Expected no diff hash unless requested, got %s", hash)
+	}
+
+	for _, runner := range []CommandRunner{DefaultCommandRunner(), bufferedCommandRunner{DefaultCommandRunner()}} {
+		if hash := InferGitInfoWithOptions(0, InferOptions{CommandRunner: runner, DiffHash: true}).DiffHash(); hash != expected {
+			t.Errorf("Expected diff hash %s, got %s", expected, hash)
+		}
+	}
+}
+
+func TestFetchFilesFromGitStatusResults(t *testing.T) {
+	modified, untracked := fetchFilesFromGitStatusResults(" M a.go\x00R  new.go\x00old.go\x00?? b.txt\x00A  c.go\x00")
+
+	if !reflect.DeepEqual(modified, []string{"a.go", "new.go", "old.go", "c.go"}) {
+		t.Errorf("Expected [a.go new.go old.go c.go], got %v", modified)
+	}
+
+	if !reflect.DeepEqual(untracked, []string{"b.txt"}) {
+		t.Errorf("Expected [b.txt], got %v", untracked)
+	}
+}
+
+func TestParseGitIndexMalformed(t *testing.T) {
+	for _, data := range []string{"", "DIRC\x00\x00\x00\x02", "DIRC\x00\x00\x00\x02=\x00\x00\x01"} {
+		if _, err := parseGitIndex([]byte(data)); err != errMalformedGitIndex {
+			t.Errorf("Expected errMalformedGitIndex for %q, got %v", data, err)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package waldo
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type gitTagRef struct {
+	annotated bool
+	date      time.Time // tagger date of annotated tags
+	name      string
+}
+
+const maxGitDescribeDepth = 10000
+
+//-----------------------------------------------------------------------------
+
+// Emulates `git describe --tags` by walking the commit graph from the given
+// commit, newest committer date first, until a tagged commit is found. The
+// distance is exact for linear history and an approximation otherwise.
+func (gr *gitRepository) describe(commit string) (string, int) {
+	tagsByCommit, err := gr.tagsByCommit()
+
+	if err != nil || len(tagsByCommit) == 0 {
+		return "", 0
+	}
+
+	start, err := gr.readCommit(commit)
+
+	if err != nil {
+		return "", 0
+	}
+
+	pending := []*gitCommit{start}
+	seen := map[string]bool{commit: true}
+
+	for distance := 0; len(pending) > 0 && distance < maxGitDescribeDepth; distance++ {
+		newest := 0
+
+		for idx, candidate := range pending {
+			if candidate.committerDate.After(pending[newest].committerDate) {
+				newest = idx
+			}
+		}
+
+		current := pending[newest]
+		pending = append(pending[:newest], pending[newest+1:]...)
+
+		if tags := tagsByCommit[current.hash]; len(tags) > 0 {
+			return bestGitTagName(tags), distance
+		}
+
+		for _, parent := range current.parents {
+			if seen[parent] {
+				continue
+			}
+
+			seen[parent] = true
+
+			if parentCommit, err := gr.readCommit(parent); err == nil {
+				pending = append(pending, parentCommit)
+			}
+		}
+	}
+
+	return "", 0
+}
+
+func (gr *gitRepository) peel(hash string) (string, *gitTagRef) {
+	var tagRef *gitTagRef
+
+	for depth := 0; depth < 10; depth++ {
+		objType, data, err := gr.readObject(hash)
+
+		if err != nil || objType != "tag" {
+			return hash, tagRef
+		}
+
+		if !strings.HasPrefix(string(data), "object ") || len(data) < 47 {
+			return hash, tagRef
+		}
+
+		if tagRef == nil {
+			tagRef = &gitTagRef{annotated: true}
+
+			for _, line := range strings.Split(string(data), "\n") {
+				if len(line) == 0 {
+					break
+				}
+
+				if strings.HasPrefix(line, "tagger ") {
+					_, tagRef.date = parseGitSignature(strings.TrimPrefix(line, "tagger "))
+				}
+			}
+		}
+
+		hash = string(data[7:47])
+	}
+
+	return hash, tagRef
+}
+
+func (gr *gitRepository) tags(commit string) []string {
+	tagsByCommit, err := gr.tagsByCommit()
+
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+
+	for _, tag := range tagsByCommit[commit] {
+		names = append(names, tag.name)
+	}
+
+	sort.Strings(names) // same order as `git tag`
+
+	return names
+}
+
+func (gr *gitRepository) tagsByCommit() (map[string][]gitTagRef, error) {
+	refs, err := gr.allRefs()
+
+	if err != nil {
+		return nil, err
+	}
+
+	tagsByCommit := make(map[string][]gitTagRef)
+
+	for name, hash := range refs {
+		if !strings.HasPrefix(name, "refs/tags/") {
+			continue
+		}
+
+		commit, tagRef := gr.peel(hash)
+
+		if tagRef == nil {
+			tagRef = &gitTagRef{}
+		}
+
+		tagRef.name = strings.TrimPrefix(name, "refs/tags/")
+
+		tagsByCommit[commit] = append(tagsByCommit[commit], *tagRef)
+	}
+
+	return tagsByCommit, nil
+}
+
+//-----------------------------------------------------------------------------
+
+func abbreviateCommit(commit string) string {
+	if len(commit) > 7 {
+		return commit[:7]
+	}
+
+	return commit
+}
+
+// Like `git describe`, prefers the most recent annotated tag, falling back to
+// the first lightweight tag by name.
+func bestGitTagName(tags []gitTagRef) string {
+	best := -1
+
+	for idx, tag := range tags {
+		switch {
+		case best == -1:
+			best = idx
+
+		case tag.annotated != tags[best].annotated:
+			if tag.annotated {
+				best = idx
+			}
+
+		case tag.date.After(tags[best].date),
+			tag.date.Equal(tags[best].date) && tag.name < tags[best].name:
+			best = idx
+		}
+	}
+
+	return tags[best].name
+}
+
+func formatGitDescription(tag string, distance int, abbrev string) string {
+	if len(tag) == 0 {
+		return ""
+	}
+
+	if distance == 0 {
+		return tag
+	}
+
+	return fmt.Sprintf("%s-%d-g%s", tag, distance, abbrev)
+}
+
+func parseGitDescribeOutput(output string) (string, int, string) {
+	output = strings.TrimSpace(output)
+
+	//
+	// With `--long`, the output is always `<tag>-<distance>-g<abbrev>`, and
+	// the tag itself may contain dashes:
+	//
+	hashDash := strings.LastIndex(output, "-g")
+
+	if hashDash == -1 {
+		return "", 0, ""
+	}
+
+	abbrev := output[hashDash+2:]
+	rest := output[:hashDash]
+
+	distanceDash := strings.LastIndex(rest, "-")
+
+	if distanceDash == -1 {
+		return "", 0, ""
+	}
+
+	distance, err := strconv.Atoi(rest[distanceDash+1:])
+
+	if err != nil {
+		return "", 0, ""
+	}
+
+	return rest[:distanceDash], distance, abbrev
+}
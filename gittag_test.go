@@ -0,0 +1,83 @@
+package waldo
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGitRepositoryDescribe(t *testing.T) {
+	dir := gitFixture(t)
+
+	commitGitFixture(t, dir, 2)
+
+	runGitFixture(t, dir, "tag", "-a", "-m", "Release 4.11.0", "v4.11.0")
+
+	commitGitFixture(t, dir, 1)
+
+	runGitFixture(t, dir, "tag", "-a", "-m", "Release 4.12.0", "v4.12.0")
+	runGitFixture(t, dir, "tag", "nightly")
+
+	commitGitFixture(t, dir, 3)
+
+	repo, _ := openGitRepository(dir, MapEnvironment{})
+
+	commit := inferFixtureCommit(repo)
+
+	expected := runGitFixture(t, dir, "describe", "--tags", "--abbrev=7", commit)
+
+	for _, packed := range []bool{false, true} {
+		if packed {
+			runGitFixture(t, dir, "gc", "--quiet")
+		}
+
+		tag, distance := repo.describe(commit)
+
+		if description := formatGitDescription(tag, distance, abbreviateCommit(commit)); description != expected {
+			t.Errorf("Expected %s, got %s (packed: %v)", expected, description, packed)
+		}
+	}
+}
+
+func TestGitRepositoryTags(t *testing.T) {
+	dir := gitFixture(t)
+
+	commitGitFixture(t, dir, 1)
+
+	runGitFixture(t, dir, "tag", "-a", "-m", "Release 4.12.0", "v4.12.0")
+	runGitFixture(t, dir, "tag", "nightly")
+	runGitFixture(t, dir, "pack-refs", "--all")
+	runGitFixture(t, dir, "tag", "-a", "-m", "Release 4.12.1", "v4.12.1")
+
+	repo, _ := openGitRepository(dir, MapEnvironment{})
+
+	commit := inferFixtureCommit(repo)
+
+	expected := strings.Split(runGitFixture(t, dir, "tag", "--points-at", commit), "\n")
+
+	if tags := repo.tags(commit); !reflect.DeepEqual(tags, expected) {
+		t.Errorf("Expected %v, got %v", expected, tags)
+	}
+
+	expectedTag := runGitFixture(t, dir, "describe", "--tags", commit)
+
+	if tag, distance := repo.describe(commit); tag != expectedTag || distance != 0 {
+		t.Errorf("Expected %s at distance 0, got %s at distance %d", expectedTag, tag, distance)
+	}
+}
+
+func TestParseGitDescribeOutput(t *testing.T) {
+	tag, distance, abbrev := parseGitDescribeOutput("release-4.12.0-rc1-3-gabc1234\n")
+
+	if tag != "release-4.12.0-rc1" || distance != 3 || abbrev != "abc1234" {
+		t.Errorf("Expected release-4.12.0-rc1, 3, abc1234, got %s, %d, %s", tag, distance, abbrev)
+	}
+
+	if description := formatGitDescription(tag, 0, abbrev); description != "release-4.12.0-rc1" {
+		t.Errorf("Expected release-4.12.0-rc1, got %s", description)
+	}
+
+	if tag, _, _ := parseGitDescribeOutput("abc1234"); tag != "" {
+		t.Errorf("Expected empty tag, got %s", tag)
+	}
+}
@@ -0,0 +1,215 @@
+package waldo
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeCertificateFixture(t *testing.T, dir, name string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		NotAfter:     time.Now().Add(time.Hour),
+		NotBefore:    time.Now().Add(-time.Hour),
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name}}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPath := filepath.Join(dir, name+".crt")
+	keyPath := filepath.Join(dir, name+".key")
+
+	os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+
+	return certPath, keyPath
+}
+
+func writeServerCAFixture(t *testing.T, server *httptest.Server) string {
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestHTTPClientCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	defer server.Close()
+
+	config := Config{}
+
+	client, _ := config.newHTTPClient()
+
+	if _, err := client.Get(server.URL); err == nil {
+		t.Errorf("Expected unknown authority error, got nil")
+	}
+
+	WithCABundle(writeServerCAFixture(t, server))(&config)
+
+	client, err := config.newHTTPClient()
+
+	if err != nil {
+		t.Fatalf("Expected client, got %v", err)
+	}
+
+	if _, err := client.Get(server.URL); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestHTTPClientInvalidCABundle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.pem")
+
+	os.WriteFile(path, []byte("not a certificate"), 0600)
+
+	config := Config{CABundlePaths: []string{path}}
+
+	if _, err := config.newHTTPClient(); err == nil {
+		t.Errorf("Expected error, got nil")
+	}
+}
+
+func TestHTTPClientInvalidProxy(t *testing.T) {
+	config := Config{ProxyURL: "http://user:secret@"}
+
+	_, err := config.newHTTPClient()
+
+	if err == nil {
+		t.Fatalf("Expected error, got nil")
+	}
+
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("Expected redacted proxy URL, got %v", err)
+	}
+}
+
+func TestHTTPClientMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeCertificateFixture(t, dir, "client")
+	certPEM, _ := os.ReadFile(certPath)
+
+	clientCAs := x509.NewCertPool()
+
+	clientCAs.AppendCertsFromPEM(certPEM)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs}
+
+	server.StartTLS()
+
+	defer server.Close()
+
+	config := Config{CABundlePaths: []string{writeServerCAFixture(t, server)}}
+
+	client, _ := config.newHTTPClient()
+
+	if _, err := client.Get(server.URL); err == nil {
+		t.Errorf("Expected handshake error without client certificate, got nil")
+	}
+
+	WithClientCertificate(certPath, keyPath)(&config)
+
+	client, err := config.newHTTPClient()
+
+	if err != nil {
+		t.Fatalf("Expected client, got %v", err)
+	}
+
+	if _, err := client.Get(server.URL); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestHTTPClientProxy(t *testing.T) {
+	var proxied string
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+
+	defer proxy.Close()
+
+	config := Config{ProxyURL: proxy.URL}
+
+	client, err := config.newHTTPClient()
+
+	if err != nil {
+		t.Fatalf("Expected client, got %v", err)
+	}
+
+	if _, err := client.Get("http://waldo.invalid/suites"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if proxied != "http://waldo.invalid/suites" {
+		t.Errorf("Expected request through proxy, got %q", proxied)
+	}
+}
+
+func TestHTTPClientTimeouts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+
+	defer server.Close()
+
+	config := Config{Timeouts: HTTPTimeouts{ResponseHeader: 20 * time.Millisecond}}
+
+	client, _ := config.newHTTPClient()
+
+	if _, err := client.Get(server.URL); err == nil {
+		t.Errorf("Expected timeout error, got nil")
+	}
+}
+
+func TestHTTPClientTransport(t *testing.T) {
+	transport := &http.Transport{}
+
+	config := Config{ProxyURL: "::invalid", Timeouts: HTTPTimeouts{Overall: time.Minute}, Transport: transport}
+
+	client, err := config.newHTTPClient()
+
+	if err != nil {
+		t.Fatalf("Expected client, got %v", err)
+	}
+
+	if client.Transport != transport || client.Timeout != time.Minute {
+		t.Errorf("Expected supplied transport and overall timeout, got %v and %v", client.Transport, client.Timeout)
+	}
+}
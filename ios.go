@@ -0,0 +1,296 @@
+package waldo
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+type IOSMetadata struct {
+	bundleID     string
+	buildNumber  string
+	displayName  string
+	executable   string
+	minOSVersion string
+	platforms    []string
+	shortVersion string
+}
+
+//-----------------------------------------------------------------------------
+
+// Reads the bundle identifier, versions, minimum OS, supported platforms and
+// display name from the `Info.plist` (XML or binary) of an `.app` bundle, of
+// the `Payload/*.app` bundle inside an `.ipa`, or of the `.app` bundle inside a
+// zip archive (such as `MyApp.app.zip`).
+func ReadIOSMetadata(buildPath string) (*IOSMetadata, error) {
+	var (
+		data []byte
+		err  error
+	)
+
+	if isDir(buildPath) {
+		data, err = os.ReadFile(filepath.Join(buildPath, "Info.plist"))
+	} else {
+		data, err = readZippedInfoPlist(buildPath)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read Info.plist of build at ‘%s’, error: %v", buildPath, err)
+	}
+
+	return parseIOSMetadata(data)
+}
+
+//-----------------------------------------------------------------------------
+
+func (im *IOSMetadata) BuildNumber() string {
+	if im == nil {
+		return ""
+	}
+
+	return im.buildNumber
+}
+
+func (im *IOSMetadata) BundleIdentifier() string {
+	if im == nil {
+		return ""
+	}
+
+	return im.bundleID
+}
+
+func (im *IOSMetadata) DisplayName() string {
+	if im == nil {
+		return ""
+	}
+
+	return im.displayName
+}
+
+// Returns the name of the main executable of the bundle.
+func (im *IOSMetadata) Executable() string {
+	if im == nil {
+		return ""
+	}
+
+	return im.executable
+}
+
+// Returns true if the bundle was built for the iOS simulator (rather than for
+// devices), according to its supported platforms.
+func (im *IOSMetadata) IsSimulatorBuild() bool {
+	return im != nil && containsString(im.platforms, "iPhoneSimulator")
+}
+
+func (im *IOSMetadata) MinimumOSVersion() string {
+	if im == nil {
+		return ""
+	}
+
+	return im.minOSVersion
+}
+
+// Returns the supported platforms, such as `iPhoneSimulator` or `iPhoneOS`.
+func (im *IOSMetadata) Platforms() []string {
+	if im == nil {
+		return nil
+	}
+
+	return im.platforms
+}
+
+func (im *IOSMetadata) ShortVersion() string {
+	if im == nil {
+		return ""
+	}
+
+	return im.shortVersion
+}
+
+//-----------------------------------------------------------------------------
+
+func (im *IOSMetadata) check(expectations *BuildExpectations) error {
+	if len(expectations.PackageName) > 0 && im.bundleID != expectations.PackageName {
+		return newCategorizedError(ErrBuildMismatch, nil, "Build bundle identifier is ‘%s’, expected ‘%s’", im.bundleID, expectations.PackageName)
+	}
+
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+func parseIOSMetadata(data []byte) (*IOSMetadata, error) {
+	plist, err := parsePlist(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dict, ok := plist.(map[string]interface{})
+
+	if !ok {
+		return nil, errMalformedPlist
+	}
+
+	plistString := func(key string) string {
+		value, _ := dict[key].(string)
+
+		return value
+	}
+
+	im := &IOSMetadata{
+		bundleID:     plistString("CFBundleIdentifier"),
+		buildNumber:  plistString("CFBundleVersion"),
+		displayName:  plistString("CFBundleDisplayName"),
+		executable:   plistString("CFBundleExecutable"),
+		minOSVersion: plistString("MinimumOSVersion"),
+		shortVersion: plistString("CFBundleShortVersionString")}
+
+	if len(im.displayName) == 0 {
+		im.displayName = plistString("CFBundleName")
+	}
+
+	platforms, _ := dict["CFBundleSupportedPlatforms"].([]interface{})
+
+	for _, platform := range platforms {
+		if name, ok := platform.(string); ok {
+			im.platforms = append(im.platforms, name)
+		}
+	}
+
+	return im, nil
+}
+
+// Checks that a zipped `.app` contains exactly one top-level bundle, which is
+// uploaded as is.
+func checkZippedApp(zipPath string) error {
+	reader, err := zip.OpenReader(zipPath)
+
+	if err != nil {
+		return err
+	}
+
+	defer reader.Close()
+
+	_, err = findZippedBundle(&reader.Reader, zipPath)
+
+	return err
+}
+
+// Returns the single `.app` bundle in the `Products/Applications` folder of an
+// Xcode archive.
+func findArchivedApp(archivePath string) (string, error) {
+	appPaths, err := filepath.Glob(filepath.Join(archivePath, "Products", "Applications", "*.app"))
+
+	if err != nil {
+		return "", err
+	}
+
+	switch len(appPaths) {
+	case 0:
+		return "", fmt.Errorf("No Products/Applications/*.app found")
+
+	case 1:
+		return appPaths[0], nil
+
+	default:
+		return "", fmt.Errorf("Found %d .app bundles in Products/Applications, expected exactly one", len(appPaths))
+	}
+}
+
+// Returns the path of the single `.app` bundle in an `.ipa` (under `Payload/`)
+// or in a zipped `.app` (at the top level).
+func findZippedBundle(zr *zip.Reader, zipPath string) (string, error) {
+	parentPath := "Payload"
+
+	if strings.EqualFold(filepath.Ext(zipPath), ".zip") {
+		parentPath = "."
+	}
+
+	var bundlePaths []string
+
+	for _, file := range zr.File {
+		bundlePath := path.Dir(file.Name)
+
+		if path.Base(file.Name) == "Info.plist" && path.Dir(bundlePath) == parentPath &&
+			strings.HasSuffix(bundlePath, ".app") && !containsString(bundlePaths, bundlePath) {
+			bundlePaths = append(bundlePaths, bundlePath)
+		}
+	}
+
+	switch len(bundlePaths) {
+	case 0:
+		return "", fmt.Errorf("No %s found", path.Join(parentPath, "*.app/Info.plist"))
+
+	case 1:
+		return bundlePaths[0], nil
+
+	default:
+		return "", fmt.Errorf("Found %d .app bundles, expected exactly one: %s", len(bundlePaths), strings.Join(bundlePaths, ", "))
+	}
+}
+
+func readIOSMachOSlices(buildPath, executable string) ([]machOSlice, error) {
+	if len(executable) == 0 || strings.Contains(executable, "/") {
+		return nil, fmt.Errorf("Invalid bundle executable: ‘%s’", executable)
+	}
+
+	if isDir(buildPath) {
+		file, err := os.Open(filepath.Join(buildPath, executable))
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer file.Close()
+
+		return readMachOSlices(file)
+	}
+
+	reader, err := zip.OpenReader(buildPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer reader.Close()
+
+	bundlePath, err := findZippedBundle(&reader.Reader, buildPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	//
+	// Zip entries are not seekable, so the executable is read in full:
+	//
+	data, err := readZipEntry(&reader.Reader, bundlePath+"/"+executable)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return readMachOSlices(bytes.NewReader(data))
+}
+
+func readZippedInfoPlist(zipPath string) ([]byte, error) {
+	reader, err := zip.OpenReader(zipPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer reader.Close()
+
+	bundlePath, err := findZippedBundle(&reader.Reader, zipPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return readZipEntry(&reader.Reader, bundlePath+"/Info.plist")
+}
@@ -0,0 +1,351 @@
+package waldo
+
+import (
+	"archive/zip"
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const infoPlistFixture = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>CFBundleIdentifier</key>
+	<string>com.example.app</string>
+	<key>CFBundleName</key>
+	<string>Example</string>
+	<key>CFBundleShortVersionString</key>
+	<string>1.2.3</string>
+	<key>CFBundleSupportedPlatforms</key>
+	<array>
+		<string>iPhoneSimulator</string>
+	</array>
+	<key>CFBundleVersion</key>
+	<string>42</string>
+	<key>LSRequiresIPhoneOS</key>
+	<true/>
+	<key>MinimumOSVersion</key>
+	<string>15.0</string>
+	<key>UIDeviceFamily</key>
+	<array>
+		<integer>1</integer>
+		<integer>2</integer>
+	</array>
+</dict>
+</plist>
+`
+
+func binaryPlistFixture(dict map[string]interface{}) []byte {
+	var objects [][]byte
+
+	addString := func(value string) byte {
+		object := []byte{0x50 | byte(len(value))}
+
+		if len(value) >= 15 {
+			object = []byte{0x5f, 0x10, byte(len(value))}
+		}
+
+		objects = append(objects, append(object, value...))
+
+		return byte(len(objects) - 1)
+	}
+
+	objects = append(objects, nil) // the top-level dict, filled in last
+
+	keys := make([]string, 0, len(dict))
+
+	for key := range dict {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	var keyRefs, valueRefs []byte
+
+	for _, key := range keys {
+		keyRefs = append(keyRefs, addString(key))
+
+		switch value := dict[key].(type) {
+		case string:
+			valueRefs = append(valueRefs, addString(value))
+
+		case []string:
+			array := []byte{0xa0 | byte(len(value))}
+
+			for _, item := range value {
+				array = append(array, addString(item))
+			}
+
+			objects = append(objects, array)
+			valueRefs = append(valueRefs, byte(len(objects)-1))
+		}
+	}
+
+	objects[0] = append(append([]byte{0xd0 | byte(len(keys))}, keyRefs...), valueRefs...)
+
+	var buffer bytes.Buffer
+
+	buffer.WriteString("bplist00")
+
+	offsets := make([]uint16, len(objects))
+
+	for idx, object := range objects {
+		offsets[idx] = uint16(buffer.Len())
+
+		buffer.Write(object)
+	}
+
+	offsetTableOffset := buffer.Len()
+
+	binary.Write(&buffer, binary.BigEndian, offsets)
+
+	trailer := make([]byte, 32)
+
+	trailer[6] = 2 // offset size
+	trailer[7] = 1 // object ref size
+
+	binary.BigEndian.PutUint64(trailer[8:], uint64(len(objects)))
+	binary.BigEndian.PutUint64(trailer[24:], uint64(offsetTableOffset))
+
+	buffer.Write(trailer)
+
+	return buffer.Bytes()
+}
+
+func ipaFixture(t *testing.T, infoPlist []byte) string {
+	ipaPath := filepath.Join(t.TempDir(), "app.ipa")
+
+	file, err := os.Create(ipaPath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	writer := zip.NewWriter(file)
+
+	for name, data := range map[string][]byte{
+		"Payload/Example.app/Example":                    []byte("binary"),
+		"Payload/Example.app/Info.plist":                 infoPlist,
+		"Payload/Example.app/PlugIns/X.appex/Info.plist": []byte("not this one")} {
+		entry, _ := writer.Create(name)
+
+		entry.Write(data)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return ipaPath
+}
+
+func TestParsePlistBinary(t *testing.T) {
+	plist, err := parsePlist(binaryPlistFixture(map[string]interface{}{
+		"CFBundleIdentifier":         "com.example.app",
+		"CFBundleSupportedPlatforms": []string{"iPhoneOS"},
+		"NSCameraUsageDescription":   "Used to scan documents"}))
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"CFBundleIdentifier":         "com.example.app",
+		"CFBundleSupportedPlatforms": []interface{}{"iPhoneOS"},
+		"NSCameraUsageDescription":   "Used to scan documents"}
+
+	if !reflect.DeepEqual(plist, expected) {
+		t.Errorf("Expected %v, got %v", expected, plist)
+	}
+}
+
+func TestParsePlistMalformed(t *testing.T) {
+	for _, data := range []string{"", "bplist00", "<plist><dict><key>A</key>"} {
+		if _, err := parsePlist([]byte(data)); err == nil {
+			t.Errorf("Expected error for %q, got nil", data)
+		}
+	}
+
+	//
+	// Extended counts and offsets large enough to overflow when added:
+	//
+	for _, object := range [][]byte{
+		{0x5f, 0x13, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 'a'},
+		{0xaf, 0x13, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		{0xdf, 0x13, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}} {
+		data := append([]byte("bplist00"), object...)
+
+		trailer := make([]byte, 32)
+
+		trailer[6] = 1 // offset size
+		trailer[7] = 1 // object ref size
+
+		binary.BigEndian.PutUint64(trailer[8:], 1)
+		binary.BigEndian.PutUint64(trailer[24:], uint64(len(data)))
+
+		data = append(append(data, 8), trailer...)
+
+		if _, err := parsePlist(data); err != errMalformedPlist {
+			t.Errorf("Expected errMalformedPlist for %x, got %v", object, err)
+		}
+
+		binary.BigEndian.PutUint64(data[len(data)-8:], 0xffffffffffffffff)
+
+		if _, err := parsePlist(data); err != errMalformedPlist {
+			t.Errorf("Expected errMalformedPlist for offset table, got %v", err)
+		}
+	}
+}
+
+func TestParsePlistXML(t *testing.T) {
+	plist, err := parsePlist([]byte(infoPlistFixture))
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	dict := plist.(map[string]interface{})
+
+	if dict["LSRequiresIPhoneOS"] != true || !reflect.DeepEqual(dict["UIDeviceFamily"], []interface{}{int64(1), int64(2)}) {
+		t.Errorf("Expected typed values, got %v", dict)
+	}
+}
+
+func TestReadIOSMetadataApp(t *testing.T) {
+	appPath := filepath.Join(t.TempDir(), "Example.app")
+
+	os.MkdirAll(appPath, 0755)
+	os.WriteFile(filepath.Join(appPath, "Info.plist"), []byte(infoPlistFixture), 0644)
+
+	metadata, err := ReadIOSMetadata(appPath)
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if metadata.BundleIdentifier() != "com.example.app" || metadata.ShortVersion() != "1.2.3" || metadata.BuildNumber() != "42" {
+		t.Errorf("Expected identifier and versions, got %+v", metadata)
+	}
+
+	if metadata.DisplayName() != "Example" || metadata.MinimumOSVersion() != "15.0" || !metadata.IsSimulatorBuild() {
+		t.Errorf("Expected display name, minimum OS and platform, got %+v", metadata)
+	}
+}
+
+func TestReadIOSMetadataIPA(t *testing.T) {
+	ipaPath := ipaFixture(t, binaryPlistFixture(map[string]interface{}{
+		"CFBundleDisplayName":        "Example Pro",
+		"CFBundleIdentifier":         "com.example.app",
+		"CFBundleShortVersionString": "2.0",
+		"CFBundleSupportedPlatforms": []string{"iPhoneOS"},
+		"CFBundleVersion":            "2.0.1"}))
+
+	metadata, err := ReadIOSMetadata(ipaPath)
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if metadata.DisplayName() != "Example Pro" || metadata.BuildNumber() != "2.0.1" || metadata.IsSimulatorBuild() {
+		t.Errorf("Expected device build metadata, got %+v", metadata)
+	}
+}
+
+func TestUploaderIOSMetadata(t *testing.T) {
+	ipaPath := ipaFixture(t, []byte(infoPlistFixture))
+
+	err := NewUploaderWithOptions(ipaPath, secretUploadToken,
+		WithBuildExpectations(BuildExpectations{PackageName: "com.example.other"}),
+		WithCommandRunner(&fakeCommandRunner{})).Validate()
+
+	if !errors.Is(err, ErrBuildMismatch) {
+		t.Errorf("Expected ErrBuildMismatch, got %v", err)
+	}
+
+	uploader := NewUploaderWithOptions(ipaPath, secretUploadToken,
+		WithCommandRunner(&fakeCommandRunner{}))
+
+	if err := uploader.Validate(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	url := uploader.makeBuildURL()
+
+	for _, expected := range []string{"appID=com.example.app", "appMinOS=15.0", "appPlatforms=iPhoneSimulator", "appVersionCode=42", "appVersionName=1.2.3"} {
+		if !strings.Contains(url, expected) {
+			t.Errorf("Expected %s in build URL, got %s", expected, url)
+		}
+	}
+}
+
+func TestUploaderXcodeArchive(t *testing.T) {
+	archivePath := filepath.Join(t.TempDir(), "Example.xcarchive")
+	appPath := appFixture(t, machOFixture(macho.CpuArm64, 7))
+
+	os.MkdirAll(filepath.Join(archivePath, "Products", "Applications"), 0755)
+	os.Rename(appPath, filepath.Join(archivePath, "Products", "Applications", "Example.app"))
+
+	uploader := NewUploaderWithOptions(archivePath, secretUploadToken,
+		WithCommandRunner(&fakeCommandRunner{}))
+
+	if err := uploader.Validate(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if filepath.Base(uploader.BuildPath()) != "Example.app" || filepath.Base(uploader.BuildPayloadPath()) != "Example.app.zip" {
+		t.Errorf("Expected archived app to be zipped, got %s", uploader.BuildPayloadPath())
+	}
+
+	err := NewUploaderWithOptions(filepath.Join(t.TempDir(), "Empty.xcarchive"), secretUploadToken,
+		WithCommandRunner(&fakeCommandRunner{})).Validate()
+
+	if !errors.Is(err, ErrInvalidBuildPath) {
+		t.Errorf("Expected ErrInvalidBuildPath, got %v", err)
+	}
+}
+
+func TestUploaderZippedApp(t *testing.T) {
+	infoPlist := binaryPlistFixture(map[string]interface{}{
+		"CFBundleExecutable": "Example",
+		"CFBundleIdentifier": "com.example.app"})
+
+	zipPath := writeZipFixture(t, "Example.app.zip", map[string][]byte{
+		"Example.app/Example":                     machOFixture(macho.CpuArm64, 7),
+		"Example.app/Info.plist":                  infoPlist,
+		"__MACOSX/Example.app/._Info.plist":       []byte("resource fork"),
+		"Example.app/PlugIns/X.appex/Info.plist":  infoPlist,
+		"Example.app/Frameworks/Y.app/Info.plist": infoPlist})
+
+	uploader := NewUploaderWithOptions(zipPath, secretUploadToken,
+		WithBuildExpectations(BuildExpectations{PackageName: "com.example.app"}),
+		WithCommandRunner(&fakeCommandRunner{}))
+
+	if err := uploader.Validate(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if uploader.BuildPayloadPath() != uploader.BuildPath() || uploader.buildContentType() != "application/zip" {
+		t.Errorf("Expected zipped app to be uploaded as is, got %s", uploader.BuildPayloadPath())
+	}
+
+	zipPath = writeZipFixture(t, "Both.app.zip", map[string][]byte{
+		"A.app/Info.plist": infoPlist,
+		"B.app/Info.plist": infoPlist})
+
+	err := NewUploaderWithOptions(zipPath, secretUploadToken,
+		WithCommandRunner(&fakeCommandRunner{})).Validate()
+
+	if !errors.Is(err, ErrInvalidBuildPath) || !strings.Contains(err.Error(), "expected exactly one") {
+		t.Errorf("Expected ErrInvalidBuildPath for two apps, got %v", err)
+	}
+}
@@ -0,0 +1,282 @@
+package waldo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Receives all diagnostics from the library: HTTP request and response dumps,
+// git commands run, CI detection decisions and build payload statistics.
+// Implementations must be safe for concurrent use.
+type Logger interface {
+	Log(level LogLevel, message string, fields ...LogField)
+}
+
+type LogField struct {
+	Key   string
+	Value interface{}
+}
+
+// The subset of `*slog.Logger` (and many other structured loggers) used by
+// NewSlogLogger.
+type SlogLogger interface {
+	Debug(message string, args ...interface{})
+	Error(message string, args ...interface{})
+	Info(message string, args ...interface{})
+	Warn(message string, args ...interface{})
+}
+
+type loggingCommandRunner struct {
+	logger Logger
+	runner CommandRunner
+}
+
+type nopLogger struct{}
+
+type redactingLogger struct {
+	logger   Logger
+	redactor *redactor
+}
+
+type slogAdapter struct {
+	logger SlogLogger
+}
+
+type textLogger struct {
+	minLevel LogLevel
+	mutex    sync.Mutex
+	writer   io.Writer // nil means the current os.Stdout
+}
+
+//-----------------------------------------------------------------------------
+
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = iota // MUST be first
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (ll LogLevel) String() string {
+	return [...]string{
+		"debug",
+		"info",
+		"warn",
+		"error"}[ll]
+}
+
+//-----------------------------------------------------------------------------
+
+func Field(key string, value interface{}) LogField {
+	return LogField{Key: key, Value: value}
+}
+
+// Returns a Logger that discards everything. This is the default unless
+// verbose output is requested.
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+// Returns a Logger that forwards to a `log/slog`-style logger, passing the
+// fields as alternating keys and values. For example:
+//
+//	waldo.WithLogger(waldo.NewSlogLogger(slog.Default()))
+func NewSlogLogger(logger SlogLogger) Logger {
+	return &slogAdapter{logger: logger}
+}
+
+// Returns a Logger that writes human-readable lines at or above the given
+// level to `writer` (or to stdout if nil). This is the default (at LevelDebug)
+// when verbose output is requested.
+func NewTextLogger(writer io.Writer, minLevel LogLevel) Logger {
+	return &textLogger{
+		minLevel: minLevel,
+		writer:   writer}
+}
+
+func WithLogger(logger Logger) Option {
+	return func(c *Config) {
+		c.Logger = logger
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func (lcr *loggingCommandRunner) LookPath(file string) (string, error) {
+	return lcr.runner.LookPath(file)
+}
+
+func (lcr *loggingCommandRunner) Run(name string, args ...string) (string, string, error) {
+	stdout, stderr, err := lcr.runner.Run(name, args...)
+
+	fields := []LogField{
+		Field("command", strings.Join(append([]string{name}, args...), " ")),
+		Field("exitCode", exitCode(err))}
+
+	if len(stderr) > 0 {
+		fields = append(fields, Field("stderr", stderr))
+	}
+
+	lcr.logger.Log(LevelDebug, "Ran command", fields...)
+
+	return stdout, stderr, err
+}
+
+func (lcr *loggingCommandRunner) runStreaming(stdout io.Writer, name string, args ...string) (string, error) {
+	stderr, err := runStreaming(lcr.runner, stdout, name, args...)
+
+	fields := []LogField{
+		Field("command", strings.Join(append([]string{name}, args...), " ")),
+		Field("exitCode", exitCode(err))}
+
+	if len(stderr) > 0 {
+		fields = append(fields, Field("stderr", stderr))
+	}
+
+	lcr.logger.Log(LevelDebug, "Ran command", fields...)
+
+	return stderr, err
+}
+
+//-----------------------------------------------------------------------------
+
+func (nl nopLogger) Log(level LogLevel, message string, fields ...LogField) {
+}
+
+//-----------------------------------------------------------------------------
+
+func (rl *redactingLogger) Log(level LogLevel, message string, fields ...LogField) {
+	redacted := make([]LogField, len(fields))
+
+	for idx, field := range fields {
+		redacted[idx] = field
+
+		switch value := field.Value.(type) {
+		case string:
+			redacted[idx].Value = rl.redactor.redact(value)
+
+		case error:
+			redacted[idx].Value = rl.redactor.redactError(value)
+		}
+	}
+
+	rl.logger.Log(level, rl.redactor.redact(message), redacted...)
+}
+
+//-----------------------------------------------------------------------------
+
+func (sa *slogAdapter) Log(level LogLevel, message string, fields ...LogField) {
+	args := make([]interface{}, 0, len(fields)*2)
+
+	for _, field := range fields {
+		args = append(args, field.Key, field.Value)
+	}
+
+	switch level {
+	case LevelDebug:
+		sa.logger.Debug(message, args...)
+
+	case LevelInfo:
+		sa.logger.Info(message, args...)
+
+	case LevelWarn:
+		sa.logger.Warn(message, args...)
+
+	default:
+		sa.logger.Error(message, args...)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func (tl *textLogger) Log(level LogLevel, message string, fields ...LogField) {
+	if level < tl.minLevel {
+		return
+	}
+
+	var (
+		blocks []string
+		sb     strings.Builder
+	)
+
+	fmt.Fprintf(&sb, "[%s] %s", strings.ToUpper(level.String()), message)
+
+	//
+	// Multi-line values (such as HTTP dumps) are easier to read on their own
+	// lines after the message:
+	//
+	for _, field := range fields {
+		value := fmt.Sprint(field.Value)
+
+		if strings.Contains(value, "\n") {
+			blocks = append(blocks, fmt.Sprintf("--- %s ---\n%s", field.Key, strings.TrimRight(value, "\r\n")))
+		} else {
+			fmt.Fprintf(&sb, " %s=%s", field.Key, quoteIfNeeded(value))
+		}
+	}
+
+	sb.WriteString("\n")
+
+	for _, block := range blocks {
+		sb.WriteString(block + "\n")
+	}
+
+	tl.mutex.Lock()
+	defer tl.mutex.Unlock()
+
+	writer := tl.writer
+
+	if writer == nil {
+		writer = os.Stdout
+	}
+
+	io.WriteString(writer, sb.String())
+}
+
+//-----------------------------------------------------------------------------
+
+func defaultLogger(verbose bool) Logger {
+	if verbose {
+		return NewTextLogger(nil, LevelDebug)
+	}
+
+	return NopLogger()
+}
+
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var exitErr *exec.ExitError
+
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+
+	return -1 // did not run, or not run by `os/exec`
+}
+
+func logCIInfo(logger Logger, ciInfo *CIInfo) {
+	logger.Log(LevelInfo, "Detected CI provider",
+		Field("provider", ciInfo.ProviderName()),
+		Field("baseBranch", ciInfo.BaseBranch()),
+		Field("gitBranch", ciInfo.GitBranch()),
+		Field("gitCommit", ciInfo.GitCommit()),
+		Field("prNumber", ciInfo.PRNumber()))
+}
+
+func quoteIfNeeded(value string) string {
+	if len(value) == 0 || strings.ContainsAny(value, " \t\"=") {
+		return fmt.Sprintf("%q", value)
+	}
+
+	return value
+}
@@ -0,0 +1,157 @@
+package waldo
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type fakeSlogLogger struct {
+	lines []string
+}
+
+type recordingLogger struct {
+	entries []string
+}
+
+func (fsl *fakeSlogLogger) Debug(message string, args ...interface{}) {
+	fsl.record("DEBUG", message, args)
+}
+
+func (fsl *fakeSlogLogger) Error(message string, args ...interface{}) {
+	fsl.record("ERROR", message, args)
+}
+
+func (fsl *fakeSlogLogger) Info(message string, args ...interface{}) {
+	fsl.record("INFO", message, args)
+}
+
+func (fsl *fakeSlogLogger) Warn(message string, args ...interface{}) {
+	fsl.record("WARN", message, args)
+}
+
+func (fsl *fakeSlogLogger) record(level, message string, args []interface{}) {
+	fsl.lines = append(fsl.lines, fmt.Sprintf("%s %s %v", level, message, args))
+}
+
+func (rl *recordingLogger) Log(level LogLevel, message string, fields ...LogField) {
+	entry := level.String() + " " + message
+
+	for _, field := range fields {
+		entry += fmt.Sprintf(" %s=%v", field.Key, field.Value)
+	}
+
+	rl.entries = append(rl.entries, entry)
+}
+
+func TestLoggingCommandRunner(t *testing.T) {
+	logger := &recordingLogger{}
+
+	runner := &loggingCommandRunner{
+		logger: logger,
+		runner: &fakeCommandRunner{outputs: map[string]string{"git rev-parse HEAD": "abc123"}}}
+
+	runner.Run("git", "rev-parse", "HEAD")
+	runner.Run("git", "status")
+
+	expected := []string{
+		"debug Ran command command=git rev-parse HEAD exitCode=0",
+		"debug Ran command command=git status exitCode=-1 stderr=fatal: unexpected command"}
+
+	if strings.Join(logger.entries, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected %q, got %q", expected, logger.entries)
+	}
+}
+
+func TestNewSlogLogger(t *testing.T) {
+	slog := &fakeSlogLogger{}
+
+	logger := NewSlogLogger(slog)
+
+	logger.Log(LevelInfo, "Detected CI provider", Field("provider", "GitHub Actions"), Field("prNumber", 42))
+	logger.Log(LevelError, "Failed")
+
+	expected := []string{
+		"INFO Detected CI provider [provider GitHub Actions prNumber 42]",
+		"ERROR Failed []"}
+
+	if strings.Join(slog.lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected %q, got %q", expected, slog.lines)
+	}
+}
+
+func TestNewTextLogger(t *testing.T) {
+	var buffer bytes.Buffer
+
+	logger := NewTextLogger(&buffer, LevelInfo)
+
+	logger.Log(LevelDebug, "Hidden")
+	logger.Log(LevelInfo, "Created build payload", Field("path", "/tmp/My App.zip"), Field("files", 3))
+	logger.Log(LevelWarn, "HTTP response", Field("dump", "HTTP/1.1 200 OK\r\n\r\n"))
+
+	expected := "[INFO] Created build payload path=\"/tmp/My App.zip\" files=3\n" +
+		"[WARN] HTTP response\n--- dump ---\nHTTP/1.1 200 OK\n"
+
+	if buffer.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buffer.String())
+	}
+}
+
+func TestRedactingLogger(t *testing.T) {
+	recorder := &recordingLogger{}
+
+	logger := &redactingLogger{
+		logger:   recorder,
+		redactor: newRedactor(&Config{UploadToken: secretUploadToken})}
+
+	logger.Log(LevelDebug, "Token "+secretUploadToken,
+		Field("error", fmt.Errorf("Bad token %s", secretUploadToken)),
+		Field("header", "Authorization: Upload-Token "+secretUploadToken))
+
+	if len(recorder.entries) != 1 || strings.Contains(recorder.entries[0], secretUploadToken) {
+		t.Errorf("Expected redacted entry, got %q", recorder.entries)
+	}
+}
+
+func TestUploaderLogsDiagnostics(t *testing.T) {
+	logger := &recordingLogger{}
+
+	uploader := NewUploaderWithOptions("app.apk", secretUploadToken,
+		WithCommandRunner(&fakeCommandRunner{}),
+		WithEnvironment(MapEnvironment{"GITHUB_ACTIONS": "true"}),
+		WithLogger(logger))
+
+	if err := uploader.Validate(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	output := strings.Join(logger.entries, "\n")
+
+	for _, expected := range []string{
+		"debug Ran command command=git",
+		"info Detected CI provider provider=GitHub Actions",
+		"info Inferred git info"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %q in log, got %q", expected, output)
+		}
+	}
+}
+
+func TestVerboseDefaultsToTextLogger(t *testing.T) {
+	config := Config{Verbose: true}
+
+	config.setDefaults()
+
+	if _, ok := config.Logger.(*textLogger); !ok {
+		t.Errorf("Expected text logger, got %T", config.Logger)
+	}
+
+	config = Config{}
+
+	config.setDefaults()
+
+	if config.Logger != NopLogger() {
+		t.Errorf("Expected no-op logger, got %T", config.Logger)
+	}
+}
@@ -0,0 +1,187 @@
+package waldo
+
+import (
+	"debug/macho"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Returned (wrapped) by Uploader.Validate when an iOS build has no code for the
+// iOS simulator, which Waldo requires. Matches ErrBuildMismatch.
+type NotSimulatorBuildError struct {
+	Architectures []string // for example, "arm64" or "x86_64"
+	Path          string
+	Platforms     []string // for example, "iOS" or "iOSSimulator"
+}
+
+type machOSlice struct {
+	arch      string
+	platform  string
+	simulator bool
+}
+
+const (
+	machOLoadBuildVersion     = 0x32
+	machOLoadVersionMinIPhone = 0x25
+)
+
+//-----------------------------------------------------------------------------
+
+func (nsbe *NotSimulatorBuildError) Error() string {
+	return fmt.Sprintf("Build at ‘%s’ is not a simulator build (architectures: %s; platforms: %s)",
+		nsbe.Path, strings.Join(nsbe.Architectures, ", "), strings.Join(nsbe.Platforms, ", "))
+}
+
+func (nsbe *NotSimulatorBuildError) Is(target error) bool {
+	return target == ErrBuildMismatch
+}
+
+//-----------------------------------------------------------------------------
+
+func checkSimulatorSlices(path string, slices []machOSlice) error {
+	var archs, platforms []string
+
+	for _, slice := range slices {
+		if slice.simulator {
+			return nil
+		}
+
+		archs = append(archs, slice.arch)
+
+		if !containsString(platforms, slice.platform) {
+			platforms = append(platforms, slice.platform)
+		}
+	}
+
+	return &NotSimulatorBuildError{
+		Architectures: archs,
+		Path:          path,
+		Platforms:     platforms}
+}
+
+func describeMachOFile(file *macho.File) machOSlice {
+	slice := machOSlice{arch: machOArchName(file.Cpu)}
+
+	for _, load := range file.Loads {
+		raw := load.Raw()
+
+		if len(raw) < 12 {
+			continue
+		}
+
+		switch file.ByteOrder.Uint32(raw) {
+		case machOLoadBuildVersion:
+			slice.platform, slice.simulator = machOPlatformName(file.ByteOrder.Uint32(raw[8:]))
+
+			return slice
+
+		case machOLoadVersionMinIPhone:
+			//
+			// Binaries built for iOS before 12 have no build version, so only
+			// the CPU type tells the simulator apart:
+			//
+			slice.simulator = file.Cpu == macho.Cpu386 || file.Cpu == macho.CpuAmd64
+
+			if slice.simulator {
+				slice.platform = "iOSSimulator"
+			} else {
+				slice.platform = "iOS"
+			}
+		}
+	}
+
+	if len(slice.platform) == 0 {
+		slice.platform = "unknown"
+	}
+
+	return slice
+}
+
+func machOArchName(cpu macho.Cpu) string {
+	switch cpu {
+	case macho.Cpu386:
+		return "i386"
+
+	case macho.CpuAmd64:
+		return "x86_64"
+
+	case macho.CpuArm:
+		return "armv7"
+
+	case macho.CpuArm64:
+		return "arm64"
+
+	default:
+		return fmt.Sprintf("cpu%d", uint32(cpu))
+	}
+}
+
+func machOPlatformName(platform uint32) (string, bool) {
+	switch platform {
+	case 1:
+		return "macOS", false
+
+	case 2:
+		return "iOS", false
+
+	case 3:
+		return "tvOS", false
+
+	case 4:
+		return "watchOS", false
+
+	case 6:
+		return "macCatalyst", false
+
+	case 7:
+		return "iOSSimulator", true
+
+	case 8:
+		return "tvOSSimulator", true
+
+	case 9:
+		return "watchOSSimulator", true
+
+	case 11:
+		return "visionOS", false
+
+	case 12:
+		return "visionOSSimulator", true
+
+	default:
+		return fmt.Sprintf("platform%d", platform), false
+	}
+}
+
+// Describes each architecture slice of a thin or fat (universal) Mach-O
+// binary.
+func readMachOSlices(reader io.ReaderAt) ([]machOSlice, error) {
+	fat, err := macho.NewFatFile(reader)
+
+	if err == nil {
+		defer fat.Close()
+
+		var slices []machOSlice
+
+		for _, arch := range fat.Arches {
+			slices = append(slices, describeMachOFile(arch.File))
+		}
+
+		return slices, nil
+	}
+
+	if err != macho.ErrNotFat {
+		return nil, err
+	}
+
+	file, err := macho.NewFile(reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	return []machOSlice{describeMachOFile(file)}, nil
+}
@@ -0,0 +1,154 @@
+package waldo
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func appFixture(t *testing.T, executable []byte) string {
+	appPath := filepath.Join(t.TempDir(), "Example.app")
+
+	infoPlist := binaryPlistFixture(map[string]interface{}{
+		"CFBundleExecutable": "Example",
+		"CFBundleIdentifier": "com.example.app"})
+
+	os.MkdirAll(appPath, 0755)
+	os.WriteFile(filepath.Join(appPath, "Example"), executable, 0755)
+	os.WriteFile(filepath.Join(appPath, "Info.plist"), infoPlist, 0644)
+
+	return appPath
+}
+
+func fatMachOFixture(slices ...[]byte) []byte {
+	const align = 12 // 4 KB
+
+	var buffer bytes.Buffer
+
+	binary.Write(&buffer, binary.BigEndian, []uint32{macho.MagicFat, uint32(len(slices))})
+
+	offset := uint32(1 << align)
+
+	for _, slice := range slices {
+		cpu := binary.LittleEndian.Uint32(slice[4:])
+		subCPU := binary.LittleEndian.Uint32(slice[8:])
+
+		binary.Write(&buffer, binary.BigEndian, []uint32{cpu, subCPU, offset, uint32(len(slice)), align})
+
+		offset += (uint32(len(slice)) + 1<<align - 1) &^ (1<<align - 1)
+	}
+
+	for _, slice := range slices {
+		buffer.Write(make([]byte, (1<<align-buffer.Len()%(1<<align))%(1<<align)))
+		buffer.Write(slice)
+	}
+
+	return buffer.Bytes()
+}
+
+// A minimal 64-bit executable with a single load command: either
+// LC_BUILD_VERSION (with the given platform) or, if platform is zero,
+// LC_VERSION_MIN_IPHONEOS.
+func machOFixture(cpu macho.Cpu, platform uint32) []byte {
+	var buffer bytes.Buffer
+
+	command := []uint32{machOLoadBuildVersion, 24, platform, 0x000f0000, 0x00110000, 0}
+
+	if platform == 0 {
+		command = []uint32{machOLoadVersionMinIPhone, 16, 0x000c0000, 0x00110000}
+	}
+
+	binary.Write(&buffer, binary.LittleEndian, []uint32{macho.Magic64, uint32(cpu), 0, uint32(macho.TypeExec), 1, uint32(len(command) * 4), 0, 0})
+	binary.Write(&buffer, binary.LittleEndian, command)
+
+	return buffer.Bytes()
+}
+
+func TestReadMachOSlicesFat(t *testing.T) {
+	slices, err := readMachOSlices(bytes.NewReader(fatMachOFixture(
+		machOFixture(macho.CpuArm64, 7),
+		machOFixture(macho.CpuAmd64, 7))))
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []machOSlice{
+		{arch: "arm64", platform: "iOSSimulator", simulator: true},
+		{arch: "x86_64", platform: "iOSSimulator", simulator: true}}
+
+	if !reflect.DeepEqual(slices, expected) {
+		t.Errorf("Expected %v, got %v", expected, slices)
+	}
+}
+
+func TestReadMachOSlicesThin(t *testing.T) {
+	for _, testCase := range []struct {
+		cpu      macho.Cpu
+		platform uint32
+		expected machOSlice
+	}{
+		{macho.CpuArm64, 2, machOSlice{arch: "arm64", platform: "iOS"}},
+		{macho.CpuArm64, 7, machOSlice{arch: "arm64", platform: "iOSSimulator", simulator: true}},
+		{macho.CpuAmd64, 0, machOSlice{arch: "x86_64", platform: "iOSSimulator", simulator: true}},
+		{macho.CpuArm64, 0, machOSlice{arch: "arm64", platform: "iOS"}}} {
+		slices, err := readMachOSlices(bytes.NewReader(machOFixture(testCase.cpu, testCase.platform)))
+
+		if err != nil || len(slices) != 1 || slices[0] != testCase.expected {
+			t.Errorf("Expected %v, got %v (%v)", testCase.expected, slices, err)
+		}
+	}
+}
+
+func TestReadMachOSlicesMalformed(t *testing.T) {
+	if _, err := readMachOSlices(bytes.NewReader([]byte("#!/bin/sh\n"))); err == nil {
+		t.Errorf("Expected error, got nil")
+	}
+}
+
+func TestUploaderDeviceApp(t *testing.T) {
+	appPath := appFixture(t, fatMachOFixture(machOFixture(macho.CpuArm64, 2)))
+
+	err := NewUploaderWithOptions(appPath, secretUploadToken,
+		WithCommandRunner(&fakeCommandRunner{})).Validate()
+
+	var buildErr *NotSimulatorBuildError
+
+	if !errors.Is(err, ErrBuildMismatch) || !errors.As(err, &buildErr) {
+		t.Fatalf("Expected NotSimulatorBuildError, got %v", err)
+	}
+
+	if !reflect.DeepEqual(buildErr.Architectures, []string{"arm64"}) || !reflect.DeepEqual(buildErr.Platforms, []string{"iOS"}) {
+		t.Errorf("Expected device architecture and platform, got %+v", buildErr)
+	}
+}
+
+func TestUploaderSimulatorApp(t *testing.T) {
+	appPath := appFixture(t, machOFixture(macho.CpuArm64, 7))
+
+	err := NewUploaderWithOptions(appPath, secretUploadToken,
+		WithCommandRunner(&fakeCommandRunner{})).Validate()
+
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestUploaderSimulatorExpectedIPA(t *testing.T) {
+	ipaPath := ipaFixture(t, binaryPlistFixture(map[string]interface{}{
+		"CFBundleExecutable": "Example",
+		"CFBundleIdentifier": "com.example.app"}))
+
+	err := NewUploaderWithOptions(ipaPath, secretUploadToken,
+		WithBuildExpectations(BuildExpectations{Simulator: true}),
+		WithCommandRunner(&fakeCommandRunner{})).Validate()
+
+	if !errors.Is(err, ErrInvalidBuildPath) {
+		t.Errorf("Expected ErrInvalidBuildPath for unreadable executable, got %v", err)
+	}
+}
@@ -0,0 +1,406 @@
+package waldo
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+type binaryPlist struct {
+	data          []byte
+	objectRefSize int
+	offsets       []uint64
+}
+
+var errMalformedPlist = errors.New("Malformed property list")
+
+//-----------------------------------------------------------------------------
+
+// Decodes a property list in either XML or binary (`bplist00`) format, as
+// found in the `Info.plist` of an iOS bundle. Values are mapped to string,
+// int64, float64, bool, time.Time, []byte, []interface{} and
+// map[string]interface{}.
+func parsePlist(data []byte) (interface{}, error) {
+	if bytes.HasPrefix(data, []byte("bplist00")) {
+		return parseBinaryPlist(data)
+	}
+
+	return parseXMLPlist(data)
+}
+
+//-----------------------------------------------------------------------------
+
+func (bp *binaryPlist) readObject(ref uint64, depth int) (interface{}, error) {
+	if ref >= uint64(len(bp.offsets)) || depth > 64 {
+		return nil, errMalformedPlist
+	}
+
+	offset := bp.offsets[ref]
+
+	if offset >= uint64(len(bp.data)) {
+		return nil, errMalformedPlist
+	}
+
+	marker := bp.data[offset]
+	kind := marker >> 4
+	info := int(marker & 0x0f)
+	start := offset + 1
+
+	switch kind {
+	case 0x0:
+		switch marker {
+		case 0x08:
+			return false, nil
+
+		case 0x09:
+			return true, nil
+
+		default:
+			return nil, nil
+		}
+
+	case 0x1:
+		size := uint64(1) << info
+
+		if size > 8 || start+size > uint64(len(bp.data)) {
+			return nil, errMalformedPlist
+		}
+
+		return int64(readBigEndian(bp.data[start : start+size])), nil
+
+	case 0x2:
+		size := uint64(1) << info
+
+		if start+size > uint64(len(bp.data)) {
+			return nil, errMalformedPlist
+		}
+
+		switch size {
+		case 4:
+			return float64(math.Float32frombits(binary.BigEndian.Uint32(bp.data[start:]))), nil
+
+		case 8:
+			return math.Float64frombits(binary.BigEndian.Uint64(bp.data[start:])), nil
+
+		default:
+			return nil, errMalformedPlist
+		}
+
+	case 0x3:
+		if start+8 > uint64(len(bp.data)) {
+			return nil, errMalformedPlist
+		}
+
+		seconds := math.Float64frombits(binary.BigEndian.Uint64(bp.data[start:]))
+
+		return time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(seconds * float64(time.Second))), nil
+	}
+
+	count, start, err := bp.readCount(info, start)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case 0x4:
+		if count > uint64(len(bp.data))-start {
+			return nil, errMalformedPlist
+		}
+
+		return bp.data[start : start+count], nil
+
+	case 0x5:
+		if count > uint64(len(bp.data))-start {
+			return nil, errMalformedPlist
+		}
+
+		return string(bp.data[start : start+count]), nil
+
+	case 0x6:
+		if count > (uint64(len(bp.data))-start)/2 {
+			return nil, errMalformedPlist
+		}
+
+		chars := make([]uint16, count)
+
+		for idx := range chars {
+			chars[idx] = binary.BigEndian.Uint16(bp.data[start+uint64(idx)*2:])
+		}
+
+		return string(utf16.Decode(chars)), nil
+
+	case 0xa:
+		refs, err := bp.readRefs(start, count)
+
+		if err != nil {
+			return nil, err
+		}
+
+		array := make([]interface{}, len(refs))
+
+		for idx, ref := range refs {
+			if array[idx], err = bp.readObject(ref, depth+1); err != nil {
+				return nil, err
+			}
+		}
+
+		return array, nil
+
+	case 0xd:
+		if count > uint64(len(bp.data)) {
+			return nil, errMalformedPlist
+		}
+
+		refs, err := bp.readRefs(start, count*2)
+
+		if err != nil {
+			return nil, err
+		}
+
+		dict := make(map[string]interface{}, count)
+
+		for idx := uint64(0); idx < count; idx++ {
+			key, err := bp.readObject(refs[idx], depth+1)
+
+			if err != nil {
+				return nil, err
+			}
+
+			keyString, ok := key.(string)
+
+			if !ok {
+				return nil, errMalformedPlist
+			}
+
+			if dict[keyString], err = bp.readObject(refs[count+idx], depth+1); err != nil {
+				return nil, err
+			}
+		}
+
+		return dict, nil
+
+	default:
+		return nil, nil // UIDs and sets are not used in Info.plist
+	}
+}
+
+func (bp *binaryPlist) readCount(info int, start uint64) (uint64, uint64, error) {
+	if info != 0x0f {
+		return uint64(info), start, nil
+	}
+
+	if start >= uint64(len(bp.data)) || bp.data[start]>>4 != 0x1 {
+		return 0, 0, errMalformedPlist
+	}
+
+	size := uint64(1) << (bp.data[start] & 0x0f)
+
+	if size > 8 || start+1+size > uint64(len(bp.data)) {
+		return 0, 0, errMalformedPlist
+	}
+
+	return readBigEndian(bp.data[start+1 : start+1+size]), start + 1 + size, nil
+}
+
+func (bp *binaryPlist) readRefs(start, count uint64) ([]uint64, error) {
+	size := uint64(bp.objectRefSize)
+
+	if count > (uint64(len(bp.data))-start)/size {
+		return nil, errMalformedPlist
+	}
+
+	refs := make([]uint64, count)
+
+	for idx := range refs {
+		offset := start + uint64(idx)*size
+
+		refs[idx] = readBigEndian(bp.data[offset : offset+size])
+	}
+
+	return refs, nil
+}
+
+//-----------------------------------------------------------------------------
+
+func parseBinaryPlist(data []byte) (interface{}, error) {
+	if len(data) < 8+32 {
+		return nil, errMalformedPlist
+	}
+
+	trailer := data[len(data)-32:]
+
+	offsetIntSize := uint64(trailer[6])
+	objectRefSize := int(trailer[7])
+	objectCount := binary.BigEndian.Uint64(trailer[8:])
+	topObject := binary.BigEndian.Uint64(trailer[16:])
+	offsetTableOffset := binary.BigEndian.Uint64(trailer[24:])
+
+	if offsetIntSize == 0 || offsetIntSize > 8 || objectRefSize == 0 || objectRefSize > 8 ||
+		objectCount > uint64(len(data)) || offsetTableOffset > uint64(len(data)) ||
+		objectCount*offsetIntSize > uint64(len(data))-offsetTableOffset {
+		return nil, errMalformedPlist
+	}
+
+	bp := &binaryPlist{
+		data:          data,
+		objectRefSize: objectRefSize,
+		offsets:       make([]uint64, objectCount)}
+
+	for idx := range bp.offsets {
+		offset := offsetTableOffset + uint64(idx)*offsetIntSize
+
+		bp.offsets[idx] = readBigEndian(data[offset : offset+offsetIntSize])
+	}
+
+	return bp.readObject(topObject, 0)
+}
+
+func parseXMLPlist(data []byte) (interface{}, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	decoder.Strict = false
+
+	for {
+		token, err := decoder.Token()
+
+		if err != nil {
+			return nil, errMalformedPlist
+		}
+
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local != "plist" {
+			return parseXMLPlistValue(decoder, start, 0)
+		}
+	}
+}
+
+func parseXMLPlistValue(decoder *xml.Decoder, start xml.StartElement, depth int) (interface{}, error) {
+	if depth > 64 {
+		return nil, errMalformedPlist
+	}
+
+	switch start.Name.Local {
+	case "array":
+		var array []interface{}
+
+		for {
+			token, err := decoder.Token()
+
+			if err != nil {
+				return nil, errMalformedPlist
+			}
+
+			switch token := token.(type) {
+			case xml.StartElement:
+				value, err := parseXMLPlistValue(decoder, token, depth+1)
+
+				if err != nil {
+					return nil, err
+				}
+
+				array = append(array, value)
+
+			case xml.EndElement:
+				return array, nil
+			}
+		}
+
+	case "dict":
+		dict := make(map[string]interface{})
+
+		key := ""
+
+		for {
+			token, err := decoder.Token()
+
+			if err != nil {
+				return nil, errMalformedPlist
+			}
+
+			switch token := token.(type) {
+			case xml.StartElement:
+				if token.Name.Local == "key" {
+					if key, err = readXMLText(decoder); err != nil {
+						return nil, err
+					}
+
+					continue
+				}
+
+				if dict[key], err = parseXMLPlistValue(decoder, token, depth+1); err != nil {
+					return nil, err
+				}
+
+			case xml.EndElement:
+				return dict, nil
+			}
+		}
+
+	case "false", "true":
+		if err := decoder.Skip(); err != nil {
+			return nil, errMalformedPlist
+		}
+
+		return start.Name.Local == "true", nil
+	}
+
+	text, err := readXMLText(decoder)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch start.Name.Local {
+	case "data":
+		return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+
+	case "date":
+		return time.Parse(time.RFC3339, strings.TrimSpace(text))
+
+	case "integer":
+		return strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+
+	case "real":
+		return strconv.ParseFloat(strings.TrimSpace(text), 64)
+
+	default:
+		return text, nil
+	}
+}
+
+func readBigEndian(data []byte) uint64 {
+	var value uint64
+
+	for _, b := range data {
+		value = value<<8 | uint64(b)
+	}
+
+	return value
+}
+
+func readXMLText(decoder *xml.Decoder) (string, error) {
+	var sb strings.Builder
+
+	for {
+		token, err := decoder.Token()
+
+		if err != nil {
+			return "", errMalformedPlist
+		}
+
+		switch token := token.(type) {
+		case xml.CharData:
+			sb.Write(token)
+
+		case xml.EndElement:
+			return sb.String(), nil
+		}
+	}
+}
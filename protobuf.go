@@ -0,0 +1,393 @@
+package waldo
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+type protoField struct {
+	data     []byte // for protoWireBytes only
+	number   int
+	value    uint64 // for the other wire types
+	wireType int
+}
+
+const (
+	protoWireVarint  = 0
+	protoWireFixed64 = 1
+	protoWireBytes   = 2
+	protoWireFixed32 = 5
+)
+
+var errMalformedProto = errors.New("Malformed protocol buffer")
+
+//-----------------------------------------------------------------------------
+
+// Decodes the start elements of a compiled Android XML file in aapt2’s
+// protocol buffer format (an `XmlNode` message), such as the
+// `AndroidManifest.xml` of an App Bundle module. Elements are returned in
+// document order, as with parseAXML.
+func parseProtoXML(data []byte) ([]axmlElement, error) {
+	var elements []axmlElement
+
+	if err := parseProtoXMLNode(data, &elements, 0); err != nil {
+		return nil, err
+	}
+
+	if len(elements) == 0 {
+		return nil, errMalformedProto
+	}
+
+	return elements, nil
+}
+
+// Decodes the simple values of a resource table in aapt2’s protocol buffer
+// format (a `ResourceTable` message), such as the `resources.pb` of an App
+// Bundle module. As with parseARSC, the first configuration found wins.
+func parseProtoResourceTable(data []byte) (*arscTable, error) {
+	table := &arscTable{values: make(map[uint32]resValue)}
+
+	err := forEachProtoField(data, func(field protoField) error {
+		if field.number != 2 || field.wireType != protoWireBytes {
+			return nil
+		}
+
+		return table.parseProtoPackage(field.data)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return table, nil
+}
+
+//-----------------------------------------------------------------------------
+
+func (at *arscTable) parseProtoPackage(data []byte) error {
+	var (
+		packageID uint32
+		types     [][]byte
+	)
+
+	err := forEachProtoField(data, func(field protoField) error {
+		switch field.number {
+		case 1:
+			packageID = protoID(field.data)
+
+		case 3:
+			types = append(types, field.data)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for _, typ := range types {
+		if err = at.parseProtoType(typ, packageID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (at *arscTable) parseProtoType(data []byte, packageID uint32) error {
+	var (
+		entries [][]byte
+		typeID  uint32
+	)
+
+	err := forEachProtoField(data, func(field protoField) error {
+		switch field.number {
+		case 1:
+			typeID = protoID(field.data)
+
+		case 3:
+			entries = append(entries, field.data)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		var (
+			entryID uint32
+			value   *resValue
+		)
+
+		err = forEachProtoField(entry, func(field protoField) error {
+			switch field.number {
+			case 1:
+				entryID = protoID(field.data)
+
+			case 6: // config_value
+				if value != nil {
+					return nil
+				}
+
+				item := protoMessage(protoMessage(field.data, 2), 4) // value.item
+
+				if item == nil {
+					return nil // a compound value, such as a style
+				}
+
+				parsed, err := parseProtoItem(item)
+
+				if err != nil {
+					return err
+				}
+
+				value = &parsed
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+
+		resID := packageID<<24 | typeID<<16 | entryID
+
+		if _, found := at.values[resID]; value != nil && !found {
+			at.values[resID] = *value
+		}
+	}
+
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// Calls `fn` for each field of the protocol buffer message in `data`.
+func forEachProtoField(data []byte, fn func(field protoField) error) error {
+	for offset := 0; offset < len(data); {
+		key, size := binary.Uvarint(data[offset:])
+
+		if size <= 0 {
+			return errMalformedProto
+		}
+
+		offset += size
+
+		field := protoField{
+			number:   int(key >> 3),
+			wireType: int(key & 0x07)}
+
+		switch field.wireType {
+		case protoWireVarint:
+			if field.value, size = binary.Uvarint(data[offset:]); size <= 0 {
+				return errMalformedProto
+			}
+
+			offset += size
+
+		case protoWireFixed64:
+			if offset+8 > len(data) {
+				return errMalformedProto
+			}
+
+			field.value = binary.LittleEndian.Uint64(data[offset:])
+			offset += 8
+
+		case protoWireBytes:
+			length, size := binary.Uvarint(data[offset:])
+
+			if size <= 0 || length > uint64(len(data)-offset-size) {
+				return errMalformedProto
+			}
+
+			offset += size
+			field.data = data[offset : offset+int(length)]
+			offset += int(length)
+
+		case protoWireFixed32:
+			if offset+4 > len(data) {
+				return errMalformedProto
+			}
+
+			field.value = uint64(binary.LittleEndian.Uint32(data[offset:]))
+			offset += 4
+
+		default:
+			return errMalformedProto
+		}
+
+		if err := fn(field); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Converts an aapt2 `Item` message to the equivalent binary resource value.
+func parseProtoItem(data []byte) (resValue, error) {
+	var value resValue
+
+	err := forEachProtoField(data, func(field protoField) error {
+		switch field.number {
+		case 1: // ref
+			value = resValue{data: protoUint32(field.data, 2), valueType: resValueReference}
+
+		case 2, 3, 4: // str, raw_str, styled_str
+			value = resValue{str: protoString(field.data, 1), valueType: resValueString}
+
+		case 7: // prim
+			return forEachProtoField(field.data, func(prim protoField) error {
+				switch prim.number {
+				case 6:
+					value = resValue{data: uint32(prim.value), valueType: resValueIntDec}
+
+				case 7:
+					value = resValue{data: uint32(prim.value), valueType: resValueIntHex}
+
+				case 8:
+					value = resValue{data: uint32(prim.value), valueType: resValueBoolean}
+				}
+
+				return nil
+			})
+		}
+
+		return nil
+	})
+
+	return value, err
+}
+
+func parseProtoXMLAttribute(data []byte) (axmlAttribute, error) {
+	var (
+		attr     axmlAttribute
+		compiled bool
+		raw      string
+	)
+
+	err := forEachProtoField(data, func(field protoField) error {
+		var err error
+
+		switch field.number {
+		case 2:
+			attr.name = string(field.data)
+
+		case 3:
+			raw = string(field.data)
+
+		case 5:
+			attr.resID = uint32(field.value)
+
+		case 6:
+			attr.value, err = parseProtoItem(field.data)
+			compiled = attr.value.valueType != 0
+		}
+
+		return err
+	})
+
+	//
+	// Attributes aapt2 could not compile (such as `package`) only have a raw
+	// string value:
+	//
+	if !compiled {
+		attr.value = resValue{str: raw, valueType: resValueString}
+	}
+
+	return attr, err
+}
+
+func parseProtoXMLNode(data []byte, elements *[]axmlElement, depth int) error {
+	if depth > 64 {
+		return errMalformedProto
+	}
+
+	element := protoMessage(data, 1)
+
+	if element == nil {
+		return nil // a text node
+	}
+
+	idx := len(*elements)
+
+	*elements = append(*elements, axmlElement{})
+
+	var children [][]byte
+
+	err := forEachProtoField(element, func(field protoField) error {
+		var err error
+
+		switch field.number {
+		case 3:
+			(*elements)[idx].name = string(field.data)
+
+		case 4:
+			var attr axmlAttribute
+
+			if attr, err = parseProtoXMLAttribute(field.data); err == nil {
+				(*elements)[idx].attributes = append((*elements)[idx].attributes, attr)
+			}
+
+		case 5:
+			children = append(children, field.data)
+		}
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for _, child := range children {
+		if err = parseProtoXMLNode(child, elements, depth+1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns the `id` of a `PackageId`, `TypeId` or `EntryId` message.
+func protoID(data []byte) uint32 {
+	return protoUint32(data, 1)
+}
+
+// Returns the last embedded message with the given field number, or nil.
+func protoMessage(data []byte, number int) []byte {
+	var message []byte
+
+	forEachProtoField(data, func(field protoField) error {
+		if field.number == number && field.wireType == protoWireBytes {
+			message = field.data
+		}
+
+		return nil
+	})
+
+	return message
+}
+
+func protoString(data []byte, number int) string {
+	return string(protoMessage(data, number))
+}
+
+func protoUint32(data []byte, number int) uint32 {
+	var value uint32
+
+	forEachProtoField(data, func(field protoField) error {
+		if field.number == number && field.wireType == protoWireVarint {
+			value = uint32(field.value)
+		}
+
+		return nil
+	})
+
+	return value
+}
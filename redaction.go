@@ -0,0 +1,108 @@
+package waldo
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+type redactedError struct {
+	err     error
+	message string
+}
+
+type redactor struct {
+	patterns []*regexp.Regexp
+	secrets  []string
+}
+
+const redactedText = "[REDACTED]"
+
+var (
+	authorizationRegexp  = regexp.MustCompile(`(?i)(authorization:[ \t]*[A-Za-z-]+[ \t]+)[^\s"]+`)
+	urlCredentialsRegexp = regexp.MustCompile(`([A-Za-z][A-Za-z0-9+.-]*://)[^/?#@\s"]+@`)
+)
+
+//-----------------------------------------------------------------------------
+
+// Masks any text matching the given patterns in verbose output and error
+// messages, in addition to the upload token, authorization headers and
+// credentials embedded in URLs, which are always masked.
+func WithRedaction(patterns ...*regexp.Regexp) Option {
+	return func(c *Config) {
+		c.RedactPatterns = append(c.RedactPatterns, patterns...)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func (re *redactedError) Error() string {
+	return re.message
+}
+
+func (re *redactedError) Unwrap() error {
+	return re.err
+}
+
+//-----------------------------------------------------------------------------
+
+func newRedactor(config *Config) *redactor {
+	r := &redactor{patterns: config.RedactPatterns}
+
+	if len(config.UploadToken) > 0 {
+		r.secrets = append(r.secrets, config.UploadToken)
+	}
+
+	return r
+}
+
+//-----------------------------------------------------------------------------
+
+func (r *redactor) redact(text string) string {
+	if r == nil {
+		return redactURLCredentials(text)
+	}
+
+	for _, secret := range r.secrets {
+		text = strings.ReplaceAll(text, secret, redactedText)
+	}
+
+	text = authorizationRegexp.ReplaceAllString(text, "${1}"+redactedText)
+	text = redactURLCredentials(text)
+
+	for _, pattern := range r.patterns {
+		text = pattern.ReplaceAllLiteralString(text, redactedText)
+	}
+
+	return text
+}
+
+// Returns an error whose message is redacted but which still wraps the
+// original error, so that `errors.Is` and `errors.As` keep working.
+func (r *redactor) redactError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	message := r.redact(err.Error())
+
+	if message == err.Error() {
+		return err
+	}
+
+	var redacted *redactedError
+
+	if errors.As(err, &redacted) {
+		err = redacted.err
+	}
+
+	return &redactedError{
+		err:     err,
+		message: message}
+}
+
+//-----------------------------------------------------------------------------
+
+func redactURLCredentials(text string) string {
+	return urlCredentialsRegexp.ReplaceAllString(text, "${1}"+redactedText+"@")
+}
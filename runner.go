@@ -0,0 +1,151 @@
+package waldo
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Runs external commands (such as `git`) on behalf of the library. Replace the
+// default with your own implementation to test code that infers git info
+// without touching a real repository.
+type CommandRunner interface {
+	// Searches for an executable in the directories named by the PATH
+	// environment variable.
+	LookPath(file string) (string, error)
+
+	// Runs the named command and returns its standard output and standard
+	// error, each with any trailing newlines removed.
+	Run(name string, args ...string) (string, string, error)
+}
+
+// Looks up environment variables on behalf of the library. Replace the default
+// with your own implementation to test code that detects CI info without
+// touching the real environment.
+type Environment interface {
+	Getenv(key string) string
+}
+
+// Settings for DetectCIInfoWithOptions, InferGitInfoWithOptions,
+// InferGitRemoteWithOptions and ComputeGitChangesWithOptions. Fields that do
+// not apply are ignored. Any zero-valued field takes its default value.
+type InferOptions struct {
+	BranchPolicy  *BranchPolicy     // InferGitInfoWithOptions only
+	CommandRunner CommandRunner     // defaults to DefaultCommandRunner()
+	Environment   Environment       // defaults to DefaultEnvironment()
+	DiffHash      bool              // InferGitInfoWithOptions only, see GitInfo.DiffHash
+	Overrides     map[string]string // DetectCIInfoWithOptions only
+}
+
+// An Environment backed by a map, most useful in tests.
+type MapEnvironment map[string]string
+
+type execCommandRunner struct{}
+
+type osEnvironment struct{}
+
+// Implemented by a CommandRunner that can copy the standard output of a command
+// to a writer as it is produced, instead of holding all of it in memory.
+type streamingCommandRunner interface {
+	runStreaming(stdout io.Writer, name string, args ...string) (string, error)
+}
+
+//-----------------------------------------------------------------------------
+
+// Returns a CommandRunner that uses `os/exec`.
+func DefaultCommandRunner() CommandRunner {
+	return execCommandRunner{}
+}
+
+// Returns an Environment that uses `os.Getenv`.
+func DefaultEnvironment() Environment {
+	return osEnvironment{}
+}
+
+//-----------------------------------------------------------------------------
+
+func (io InferOptions) commandRunner() CommandRunner {
+	if io.CommandRunner == nil {
+		return DefaultCommandRunner()
+	}
+
+	return io.CommandRunner
+}
+
+func (io InferOptions) environment() Environment {
+	if io.Environment == nil {
+		return DefaultEnvironment()
+	}
+
+	return io.Environment
+}
+
+//-----------------------------------------------------------------------------
+
+func (me MapEnvironment) Getenv(key string) string {
+	return me[key]
+}
+
+//-----------------------------------------------------------------------------
+
+func (ecr execCommandRunner) LookPath(file string) (string, error) {
+	return exec.LookPath(file)
+}
+
+func (ecr execCommandRunner) Run(name string, args ...string) (string, string, error) {
+	return run(name, args...)
+}
+
+func (ecr execCommandRunner) runStreaming(stdout io.Writer, name string, args ...string) (string, error) {
+	var stderrBuffer bytes.Buffer
+
+	cmd := exec.Command(name, args...)
+
+	cmd.Stderr = &stderrBuffer
+
+	pipe, err := cmd.StdoutPipe()
+
+	if err != nil {
+		return "", err
+	}
+
+	if err = cmd.Start(); err != nil {
+		return "", err
+	}
+
+	_, copyErr := io.Copy(stdout, pipe)
+
+	err = cmd.Wait()
+
+	if err == nil {
+		err = copyErr
+	}
+
+	return strings.TrimRight(stderrBuffer.String(), "\n"), err
+}
+
+//-----------------------------------------------------------------------------
+
+func (oe osEnvironment) Getenv(key string) string {
+	return os.Getenv(key)
+}
+
+//-----------------------------------------------------------------------------
+
+// Copies the standard output of the named command to the writer and returns its
+// standard error. A runner that cannot stream has its output buffered instead.
+func runStreaming(runner CommandRunner, stdout io.Writer, name string, args ...string) (string, error) {
+	if streamer, ok := runner.(streamingCommandRunner); ok {
+		return streamer.runStreaming(stdout, name, args...)
+	}
+
+	output, stderr, err := runner.Run(name, args...)
+
+	if err == nil && len(output) > 0 {
+		_, err = io.WriteString(stdout, output+"\n")
+	}
+
+	return stderr, err
+}
@@ -0,0 +1,118 @@
+package waldo
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type fakeCommandRunner struct {
+	calls   []string
+	outputs map[string]string
+}
+
+func (fcr *fakeCommandRunner) LookPath(file string) (string, error) {
+	return "/usr/bin/" + file, nil
+}
+
+func (fcr *fakeCommandRunner) Run(name string, args ...string) (string, string, error) {
+	command := strings.Join(append([]string{name}, args...), " ")
+
+	fcr.calls = append(fcr.calls, command)
+
+	if output, found := fcr.outputs[command]; found {
+		return output, "", nil
+	}
+
+	return "", "fatal: unexpected command", errors.New("exit status 128")
+}
+
+func TestDetectCIInfoWithOptions(t *testing.T) {
+	env := MapEnvironment{
+		"GITHUB_ACTIONS":                     "true",
+		"GITHUB_BASE_REF":                    "main",
+		"GITHUB_EVENT_NAME":                  "pull_request",
+		"GITHUB_EVENT_PULL_REQUEST_HEAD_SHA": "4444444444444444444444444444444444444444",
+		"GITHUB_HEAD_REF":                    "feature/hermetic",
+		"GITHUB_REF_TYPE":                    "branch"}
+
+	ci := DetectCIInfoWithOptions(true, InferOptions{Environment: env})
+
+	if ci.Provider() != GitHubActions {
+		t.Errorf("Expected GitHubActions, got %v", ci.Provider())
+	}
+
+	if ci.GitBranch() != "feature/hermetic" {
+		t.Errorf("Expected feature/hermetic, got %v", ci.GitBranch())
+	}
+
+	if ci.GitCommit() != "4444444444444444444444444444444444444444" {
+		t.Errorf("Expected head commit, got %v", ci.GitCommit())
+	}
+
+	if ci.BaseBranch() != "main" {
+		t.Errorf("Expected main, got %v", ci.BaseBranch())
+	}
+
+	if ci.SkipCount() != 1 {
+		t.Errorf("Expected 1, got %v", ci.SkipCount())
+	}
+}
+
+func TestDetectCIInfoWithOptionsUnknown(t *testing.T) {
+	if ci := DetectCIInfoWithOptions(true, InferOptions{Environment: MapEnvironment{}}); ci.Provider() != Unknown {
+		t.Errorf("Expected Unknown, got %v", ci.Provider())
+	}
+}
+
+func TestInferGitInfoWithOptions(t *testing.T) {
+	commit := "5555555555555555555555555555555555555555"
+
+	runner := &fakeCommandRunner{outputs: map[string]string{
+		"git rev-parse":                                                   "",
+		"git rev-parse --is-shallow-repository":                           "false",
+		"git log --format=%H --skip=0 -1":                                 commit,
+		"git for-each-ref --points-at=" + commit + " --format=%(refname)": "refs/heads/main",
+		"git symbolic-ref --quiet HEAD":                                   "refs/heads/main",
+		"git cat-file commit " + commit:                                   "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\nauthor Ada <ada@example.com> 1650000000 +0000\ncommitter Ada <ada@example.com> 1650000000 +0000\n\nHermetic commit\n",
+		"git status --porcelain -z --untracked-files=all":                 "",
+		"git config --get-regexp ^remote\\..*\\.url$":                     "remote.origin.url git@github.com:acme/app.git"}}
+
+	gitInfo := InferGitInfoWithOptions(0, InferOptions{CommandRunner: runner})
+
+	if gitInfo.Access() != Ok {
+		t.Errorf("Expected Ok, got %v", gitInfo.Access())
+	}
+
+	if gitInfo.Commit() != commit {
+		t.Errorf("Expected %s, got %s", commit, gitInfo.Commit())
+	}
+
+	if gitInfo.Branch() != "main" {
+		t.Errorf("Expected main, got %s", gitInfo.Branch())
+	}
+
+	if gitInfo.CommitSubject() != "Hermetic commit" {
+		t.Errorf("Expected Hermetic commit, got %s", gitInfo.CommitSubject())
+	}
+
+	if gitInfo.IsDetachedHead() || gitInfo.IsDirty() {
+		t.Errorf("Expected attached and clean, got %v and %v", gitInfo.IsDetachedHead(), gitInfo.IsDirty())
+	}
+
+	if gitInfo.Remote().Identity() != "github.com/acme/app" {
+		t.Errorf("Expected github.com/acme/app, got %s", gitInfo.Remote().Identity())
+	}
+}
+
+func TestInferGitInfoWithOptionsNotRepository(t *testing.T) {
+	runner := &fakeCommandRunner{}
+
+	if gitInfo := InferGitInfoWithOptions(0, InferOptions{CommandRunner: runner}); gitInfo.Access() != NotGitRepository {
+		t.Errorf("Expected NotGitRepository, got %v", gitInfo.Access())
+	}
+
+	if len(runner.calls) != 1 {
+		t.Errorf("Expected 1 command, got %v", runner.calls)
+	}
+}
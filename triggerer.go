@@ -2,44 +2,91 @@ package waldo
 
 import (
 	"fmt"
-	"io"
 	"net/http"
 	"net/http/httputil"
-	"regexp"
-	"strconv"
 	"strings"
 )
 
 type Triggerer struct {
-	userOverrides   map[string]string
-	userRuleName    string
-	userUploadToken string
-	userVerbose     bool
-
-	arch      string
-	ciInfo    *CIInfo
-	platform  string
-	validated bool
+	config Config
+
+	arch          string
+	ciInfo        *CIInfo
+	client        *http.Client
+	dryRunRequest *DryRunRequest
+	flowNames     []string
+	flowTags      []string
+	gitRemote     *GitRemote
+	logger        Logger
+	platform      string
+	redactor      *redactor
+	skipped       bool
+	validated     bool
 }
 
 //-----------------------------------------------------------------------------
 
+// Kept for compatibility; prefer NewTriggererWithOptions.
 func NewTriggerer(uploadToken, ruleName string, verbose bool, overrides map[string]string) *Triggerer {
+	return NewTriggererWithOptions(uploadToken,
+		WithOverrides(overrides),
+		WithRuleName(ruleName),
+		WithVerbose(verbose))
+}
+
+func NewTriggererWithConfig(config Config) *Triggerer {
+	config.setDefaults()
+
+	redactor := newRedactor(&config)
+
 	return &Triggerer{
-		userOverrides:   overrides,
-		userRuleName:    ruleName,
-		userUploadToken: uploadToken,
-		userVerbose:     verbose}
+		config: config,
+		logger: &redactingLogger{
+			logger:   config.Logger,
+			redactor: redactor},
+		redactor: redactor}
+}
+
+func NewTriggererWithOptions(uploadToken string, options ...Option) *Triggerer {
+	config := Config{UploadToken: uploadToken}
+
+	config.apply(options)
+
+	return NewTriggererWithConfig(config)
 }
 
 //-----------------------------------------------------------------------------
 
+// Returns the request that would have been sent by the last call to Perform in
+// dry-run mode, or nil.
+func (t *Triggerer) DryRunRequest() *DryRunRequest {
+	return t.dryRunRequest
+}
+
+// Returns the flow names selected from the flow mapping file (if any). Empty
+// unless Validate was able to determine the affected flows.
+func (t *Triggerer) FlowNames() []string {
+	return t.flowNames
+}
+
+// Returns the flow tags selected from the flow mapping file (if any). Empty
+// unless Validate was able to determine the affected flows.
+func (t *Triggerer) FlowTags() []string {
+	return t.flowTags
+}
+
 func (t *Triggerer) RuleName() string {
-	return t.userRuleName
+	return t.config.RuleName
+}
+
+// Returns true if Validate determined from the flow mapping file that the
+// changes do not affect any flow, in which case Perform does nothing.
+func (t *Triggerer) Skipped() bool {
+	return t.skipped
 }
 
 func (t *Triggerer) UploadToken() string {
-	return t.userUploadToken
+	return t.config.UploadToken
 }
 
 func (t *Triggerer) Version() string {
@@ -53,157 +100,198 @@ func (t *Triggerer) Version() string {
 //-----------------------------------------------------------------------------
 
 func (t *Triggerer) Perform() error {
-	return t.triggerRun()
-}
+	if t.skipped {
+		t.logger.Log(LevelInfo, "No flows affected by the changes, not triggering a run")
 
-func (t *Triggerer) Validate() error {
-	if t.validated {
 		return nil
 	}
 
-	err := validateUploadToken(t.userUploadToken)
-
-	if err != nil {
-		return err
-	}
-
-	t.arch = detectArch()
-	t.ciInfo = DetectCIInfo(false)
-	t.platform = detectPlatform()
-	t.validated = true
+	return t.redactor.redactError(t.triggerRun())
+}
 
-	return nil
+func (t *Triggerer) Validate() error {
+	return t.redactor.redactError(t.validate())
 }
 
 //-----------------------------------------------------------------------------
 
 func (t *Triggerer) authorization() string {
-	return fmt.Sprintf("Upload-Token %s", t.userUploadToken)
+	return fmt.Sprintf("Upload-Token %s", t.config.UploadToken)
 }
 
-func (t *Triggerer) checkTriggerStatus(resp *http.Response) error {
-	body, err := io.ReadAll(resp.Body)
+func (t *Triggerer) commandRunner() CommandRunner {
+	return &loggingCommandRunner{
+		logger: t.logger,
+		runner: t.config.CommandRunner}
+}
 
-	if err != nil {
-		return err
-	}
+func (t *Triggerer) contentType() string {
+	return "application/json"
+}
 
-	bodyString := string(body)
+func (t *Triggerer) dumpRequest(req *http.Request, body bool) {
+	dump, err := httputil.DumpRequestOut(req, body)
 
-	statusRegex := regexp.MustCompile(`"status":([0-9]+)`)
-	statusMatches := statusRegex.FindStringSubmatch(bodyString)
+	if err == nil {
+		t.logger.Log(LevelDebug, "HTTP request", Field("dump", string(dump)))
+	}
+}
 
-	if len(statusMatches) > 0 { // status is numeric _only_ on failure
-		var status = 0
+func (t *Triggerer) dumpResponse(resp *http.Response, body bool) {
+	dump, err := httputil.DumpResponse(resp, body)
 
-		status, err = strconv.Atoi(statusMatches[1])
+	if err == nil {
+		t.logger.Log(LevelDebug, "HTTP response", Field("dump", string(dump)))
+	}
+}
 
-		if err != nil {
-			return err
-		}
+func (t *Triggerer) httpClient() *http.Client {
+	if t.client == nil {
+		t.client = &http.Client{} // not validated
+	}
 
-		if status == 401 {
-			return fmt.Errorf("Upload token is invalid or missing!")
-		}
+	return t.client
+}
 
-		if status < 200 || status > 299 {
-			return fmt.Errorf("Unable to trigger run on Waldo, HTTP status: %d", status)
-		}
+func (t *Triggerer) makePayload() string {
+	payload := make(map[string]interface{})
+
+	appendIfNotEmpty(payload, "agentName", agentName)
+	appendIfNotEmpty(payload, "agentVersion", agentVersion)
+	appendIfNotEmpty(payload, "arch", t.arch)
+	appendIfNotEmpty(payload, "ci", t.ciInfo.ProviderName())
+	appendListIfNotEmpty(payload, "flowNames", t.flowNames)
+	appendListIfNotEmpty(payload, "flowTags", t.flowTags)
+	appendIfNotEmpty(payload, "gitRepository", t.gitRemote.Identity())
+	appendIfNotEmpty(payload, "platform", t.platform)
+
+	//
+	// The selected flows replace the rule name; without them, fall back to
+	// running every flow matched by the rule name:
+	//
+	if len(t.flowNames) == 0 && len(t.flowTags) == 0 {
+		appendIfNotEmpty(payload, "ruleName", t.config.RuleName)
 	}
 
-	return nil
+	appendIfNotEmpty(payload, "wrapperName", t.config.WrapperName)
+	appendIfNotEmpty(payload, "wrapperVersion", t.config.WrapperVersion)
+
+	return marshalPayload(payload)
 }
 
-func (t *Triggerer) contentType() string {
-	return "application/json"
+func (t *Triggerer) makeURL() string {
+	return t.config.triggerEndpoint()
 }
 
-func (t *Triggerer) dumpRequest(req *http.Request, body bool) {
-	if t.userVerbose {
-		dump, err := httputil.DumpRequestOut(req, body)
+// Returns the flow names and flow tags affected by the changes against the
+// target branch, and whether any flow is affected at all. Empty lists with a
+// true result mean that all flows matching the rule name must run instead.
+func (t *Triggerer) selectAffectedFlows(mappings []flowMapping) ([]string, []string, bool) {
+	target := t.config.GitTargetBranch
 
-		if err == nil {
-			fmt.Printf("\n--- Request ---\n%s\n", dump)
-		}
+	if len(target) == 0 {
+		target = t.ciInfo.BaseBranch()
 	}
-}
 
-func (t *Triggerer) dumpResponse(resp *http.Response, body bool) {
-	if t.userVerbose {
-		dump, err := httputil.DumpResponse(resp, body)
+	if len(target) == 0 {
+		t.logger.Log(LevelInfo, "No target branch to compare against, running all flows")
 
-		if err == nil {
-			fmt.Printf("\n--- Response ---\n%s\n", dump)
-		}
+		return nil, nil, true
 	}
-}
 
-func (t *Triggerer) makePayload() string {
-	payload := ""
+	changeSet, err := ComputeGitChangesWithOptions("", target, InferOptions{CommandRunner: t.commandRunner()})
 
-	appendIfNotEmpty(&payload, "agentName", agentName)
-	appendIfNotEmpty(&payload, "agentVersion", agentVersion)
-	appendIfNotEmpty(&payload, "arch", t.arch)
-	appendIfNotEmpty(&payload, "ci", t.ciInfo.Provider().String())
-	appendIfNotEmpty(&payload, "platform", t.platform)
-	appendIfNotEmpty(&payload, "ruleName", t.userRuleName)
-	appendIfNotEmpty(&payload, "wrapperName", t.userOverrides["wrapperName"])
-	appendIfNotEmpty(&payload, "wrapperVersion", t.userOverrides["wrapperVersion"])
+	if err != nil {
+		t.logger.Log(LevelWarn, "Unable to compute changes, running all flows",
+			Field("error", err),
+			Field("target", target))
 
-	payload = "{" + payload + "}"
+		return nil, nil, true
+	}
 
-	return payload
-}
+	paths := changeSet.Paths()
 
-func (t *Triggerer) makeURL() string {
-	triggerURL := t.userOverrides["apiTriggerEndpoint"]
+	if len(paths) == 0 {
+		t.logger.Log(LevelInfo, "No changed files against target branch, running all flows",
+			Field("target", target))
+
+		return nil, nil, true
+	}
 
-	if len(triggerURL) == 0 {
-		triggerURL = defaultAPITriggerEndpoint
+	names, tags, complete := selectFlows(mappings, paths)
+
+	if !complete {
+		t.logger.Log(LevelInfo, "Changed files not fully covered by flow mapping, running all flows",
+			Field("changes", len(changeSet.Changes())),
+			Field("target", target))
+
+		return nil, nil, true
 	}
 
-	return triggerURL
+	if len(names) == 0 && len(tags) == 0 {
+		t.logger.Log(LevelInfo, "Changed files do not affect any flow",
+			Field("changes", len(changeSet.Changes())),
+			Field("target", target))
+
+		return nil, nil, false
+	}
+
+	t.logger.Log(LevelInfo, "Selected affected flows",
+		Field("flowNames", strings.Join(names, ",")),
+		Field("flowTags", strings.Join(tags, ",")),
+		Field("target", target))
+
+	return names, tags, true
 }
 
 func (t *Triggerer) triggerRun() error {
 	url := t.makeURL()
 	body := t.makePayload()
 
-	client := &http.Client{}
+	client := t.httpClient()
 
 	req, err := http.NewRequest("POST", url, strings.NewReader(body))
 
 	if err != nil {
-		return fmt.Errorf("Unable to trigger run on Waldo, error: %v, url: %s", err, url)
+		return fmt.Errorf("Unable to trigger run on Waldo, error: %w, url: %s", err, url)
 	}
 
 	req.Header.Add("Authorization", t.authorization())
 	req.Header.Add("Content-Type", t.contentType())
 	req.Header.Add("User-Agent", t.userAgent())
 
+	if t.config.DryRun {
+		t.dryRunRequest = logDryRunRequest(t.logger, req, body, int64(len(body)), t.redactor)
+
+		return nil
+	}
+
 	t.dumpRequest(req, true)
 
 	resp, err := client.Do(req)
 
 	if err != nil {
-		return fmt.Errorf("Unable to trigger run on Waldo, error: %v, url: %s", err, url)
+		return &NetworkError{
+			Action: "trigger run on Waldo",
+			Err:    err,
+			URL:    url}
 	}
 
 	t.dumpResponse(resp, true)
 
 	defer resp.Body.Close()
 
-	return t.checkTriggerStatus(resp)
+	return checkResponseStatus(resp, "trigger run on Waldo")
 }
 
 func (t *Triggerer) userAgent() string {
-	ci := t.ciInfo.Provider().String()
+	ci := t.ciInfo.ProviderName()
 
 	if ci == "Unknown" {
 		ci = "Go CLI" // hack for now…
 	}
 
-	version := t.userOverrides["wrapperVersion"]
+	version := t.config.WrapperVersion
 
 	if len(version) == 0 {
 		version = agentVersion
@@ -211,3 +299,52 @@ func (t *Triggerer) userAgent() string {
 
 	return fmt.Sprintf("Waldo %s v%s", ci, version)
 }
+
+func (t *Triggerer) validate() error {
+	if t.validated {
+		return nil
+	}
+
+	err := validateUploadToken(t.config.UploadToken)
+
+	if err != nil {
+		return err
+	}
+
+	client, err := t.config.newHTTPClient()
+
+	if err != nil {
+		return err
+	}
+
+	var mappings []flowMapping
+
+	if mapPath := t.config.FlowMapPath; len(mapPath) > 0 {
+		if mappings, err = loadFlowMap(mapPath); err != nil {
+			return err
+		}
+	}
+
+	t.arch = detectArch()
+	t.ciInfo = DetectCIInfoWithOptions(len(mappings) > 0, InferOptions{
+		Environment: t.config.Environment,
+		Overrides:   t.config.Overrides})
+	t.client = client
+	t.gitRemote = InferGitRemoteWithOptions(InferOptions{
+		CommandRunner: t.commandRunner(),
+		Environment:   t.config.Environment})
+	t.platform = detectPlatform()
+
+	logCIInfo(t.logger, t.ciInfo)
+
+	if len(mappings) > 0 {
+		var affected bool
+
+		t.flowNames, t.flowTags, affected = t.selectAffectedFlows(mappings)
+		t.skipped = !affected
+	}
+
+	t.validated = true
+
+	return nil
+}
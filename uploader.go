@@ -2,59 +2,85 @@ package waldo
 
 import (
 	"fmt"
-	"io"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
 )
 
 type Uploader struct {
-	userBuildPath   string
-	userGitBranch   string
-	userGitCommit   string
-	userOverrides   map[string]string
-	userUploadToken string
-	userVariantName string
-	userVerbose     bool
+	config Config
 
+	androidMetadata  *AndroidMetadata
 	arch             string
+	buildEntry       string
 	buildPath        string
 	buildPayloadPath string
 	buildSuffix      string
 	ciInfo           *CIInfo
+	client           *http.Client
+	dryRunRequest    *DryRunRequest
 	flavor           string
 	gitInfo          *GitInfo
+	iosMetadata      *IOSMetadata
+	logger           Logger
 	platform         string
+	redactor         *redactor
 	validated        bool
 	workingPath      string
 }
 
 //-----------------------------------------------------------------------------
 
+// Kept for compatibility; prefer NewUploaderWithOptions.
 func NewUploader(buildPath, uploadToken, variantName, gitCommit, gitBranch string, verbose bool, overrides map[string]string) *Uploader {
+	return NewUploaderWithOptions(buildPath, uploadToken,
+		WithGitBranch(gitBranch),
+		WithGitCommit(gitCommit),
+		WithOverrides(overrides),
+		WithVariantName(variantName),
+		WithVerbose(verbose))
+}
+
+func NewUploaderWithConfig(config Config) *Uploader {
+	config.setDefaults()
+
+	redactor := newRedactor(&config)
+
 	return &Uploader{
-		userBuildPath:   buildPath,
-		userGitBranch:   gitBranch,
-		userGitCommit:   gitCommit,
-		userOverrides:   overrides,
-		userUploadToken: uploadToken,
-		userVariantName: variantName,
-		userVerbose:     verbose}
+		config: config,
+		logger: &redactingLogger{
+			logger:   config.Logger,
+			redactor: redactor},
+		redactor: redactor}
+}
+
+func NewUploaderWithOptions(buildPath, uploadToken string, options ...Option) *Uploader {
+	config := Config{
+		BuildPath:   buildPath,
+		UploadToken: uploadToken}
+
+	config.apply(options)
+
+	return NewUploaderWithConfig(config)
 }
 
 //-----------------------------------------------------------------------------
 
+// Returns the metadata read from an Android build by Validate, or nil.
+func (u *Uploader) AndroidMetadata() *AndroidMetadata {
+	return u.androidMetadata
+}
+
 func (u *Uploader) BuildPath() string {
 	if u.validated {
 		return u.buildPath
 	}
 
-	return u.userBuildPath
+	return u.config.BuildPath
 }
 
 func (u *Uploader) BuildPayloadPath() string {
@@ -70,7 +96,13 @@ func (u *Uploader) CIGitCommit() string {
 }
 
 func (u *Uploader) CIProvider() string {
-	return u.ciInfo.Provider().String()
+	return u.ciInfo.ProviderName()
+}
+
+// Returns the request that would have been sent by the last call to Upload in
+// dry-run mode, or nil.
+func (u *Uploader) DryRunRequest() *DryRunRequest {
+	return u.dryRunRequest
 }
 
 func (u *Uploader) GitAccess() string {
@@ -78,11 +110,16 @@ func (u *Uploader) GitAccess() string {
 }
 
 func (u *Uploader) GitBranch() string {
-	return u.userGitBranch
+	return u.config.GitBranch
 }
 
 func (u *Uploader) GitCommit() string {
-	return u.userGitCommit
+	return u.config.GitCommit
+}
+
+// Returns the metadata read from an iOS build by Validate, or nil.
+func (u *Uploader) IOSMetadata() *IOSMetadata {
+	return u.iosMetadata
 }
 
 func (u *Uploader) InferredGitBranch() string {
@@ -94,11 +131,11 @@ func (u *Uploader) InferredGitCommit() string {
 }
 
 func (u *Uploader) UploadToken() string {
-	return u.userUploadToken
+	return u.config.UploadToken
 }
 
 func (u *Uploader) VariantName() string {
-	return u.userVariantName
+	return u.config.VariantName
 }
 
 func (u *Uploader) Version() string {
@@ -129,56 +166,75 @@ func (u *Uploader) Upload() error {
 	}
 
 	if err != nil {
-		u.uploadError(err)
+		u.reportError(err)
+	} else {
+		u.flushErrorReports()
 	}
 
-	return err
+	return u.redactor.redactError(err)
 }
 
 func (u *Uploader) Validate() error {
-	if u.validated {
-		return nil
-	}
+	return u.redactor.redactError(u.validate())
+}
 
-	err := validateUploadToken(u.userUploadToken)
+//-----------------------------------------------------------------------------
 
-	if err != nil {
-		return err
+func (u *Uploader) appID() string {
+	if u.androidMetadata != nil {
+		return u.androidMetadata.PackageName()
 	}
 
-	buildPath, buildSuffix, flavor, err := validateBuildPath(u.userBuildPath)
-
-	if err != nil {
-		// u.uploadError(err) ???
+	return u.iosMetadata.BundleIdentifier()
+}
 
-		return err
+func (u *Uploader) appVersionCode() string {
+	if u.androidMetadata != nil {
+		return formatInt(u.androidMetadata.VersionCode())
 	}
 
-	workingPath := determineWorkingPath()
+	return u.iosMetadata.BuildNumber()
+}
 
-	u.arch = detectArch()
-	u.buildPath = buildPath
-	u.buildPayloadPath = determineBuildPayloadPath(workingPath, buildPath, buildSuffix)
-	u.buildSuffix = buildSuffix
-	u.ciInfo = DetectCIInfo(true)
-	u.flavor = flavor
-	u.gitInfo = InferGitInfo(u.ciInfo.SkipCount())
-	u.platform = detectPlatform()
-	u.validated = true
-	u.workingPath = workingPath
+func (u *Uploader) appVersionName() string {
+	if u.androidMetadata != nil {
+		return u.androidMetadata.VersionName()
+	}
 
-	return nil
+	return u.iosMetadata.ShortVersion()
 }
 
-//-----------------------------------------------------------------------------
-
 func (u *Uploader) authorization() string {
-	return fmt.Sprintf("Upload-Token %s", u.userUploadToken)
+	return fmt.Sprintf("Upload-Token %s", u.config.UploadToken)
+}
+
+func (u *Uploader) branchPolicy() *BranchPolicy {
+	policy := defaultBranchPolicy()
+
+	policy.CIBranch = u.ciInfo.GitBranch()
+	policy.CICommit = u.ciInfo.GitCommit()
+	policy.DefaultBranch = u.config.GitDefaultBranch
+	policy.DefaultBranchName = u.config.GitDefaultBranchName
+	policy.Patterns = u.config.GitBranchPatterns
+
+	if preferLocal := u.config.GitPreferLocalBranch; preferLocal != nil && !*preferLocal {
+		policy.PreferLocal = false
+		policy.PreferRemote = true
+	}
+
+	return policy
 }
 
 func (u *Uploader) buildContentType() string {
 	switch u.buildSuffix {
-	case "app":
+	case "app", "zip":
+		return "application/zip"
+
+	case "apks":
+		if len(u.buildEntry) > 0 {
+			return "application/octet-stream" // the extracted APK
+		}
+
 		return "application/zip"
 
 	default:
@@ -186,37 +242,32 @@ func (u *Uploader) buildContentType() string {
 	}
 }
 
-func (u *Uploader) checkBuildStatus(resp *http.Response) error {
-	body, err := io.ReadAll(resp.Body)
+func (u *Uploader) checkSimulatorBuild(buildPath string, required bool) error {
+	slices, err := readIOSMachOSlices(buildPath, u.iosMetadata.Executable())
 
 	if err != nil {
-		return err
-	}
-
-	bodyString := string(body)
-
-	statusRegex := regexp.MustCompile(`"status":([0-9]+)`)
-	statusMatches := statusRegex.FindStringSubmatch(bodyString)
-
-	if len(statusMatches) > 0 { // status is numeric _only_ on failure
-		var status = 0
+		if !required {
+			u.logger.Log(LevelWarn, "Unable to read build executable", Field("error", err))
 
-		status, err = strconv.Atoi(statusMatches[1])
-
-		if err != nil {
-			return err
+			return nil // let Waldo decide
 		}
 
-		if status == 401 {
-			return fmt.Errorf("Upload token is invalid or missing!")
-		}
+		return newCategorizedError(ErrInvalidBuildPath, err, "Unable to read executable of build at ‘%s’, error: %v", buildPath, err)
+	}
 
-		if status < 200 || status > 299 {
-			return fmt.Errorf("Unable to upload build to Waldo, HTTP status: %d", status)
-		}
+	for _, slice := range slices {
+		u.logger.Log(LevelInfo, "Read build executable",
+			Field("arch", slice.arch),
+			Field("platform", slice.platform))
 	}
 
-	return nil
+	return checkSimulatorSlices(buildPath, slices)
+}
+
+func (u *Uploader) commandRunner() CommandRunner {
+	return &loggingCommandRunner{
+		logger: u.logger,
+		runner: u.config.CommandRunner}
 }
 
 func (u *Uploader) createBuildPayload() error {
@@ -226,14 +277,49 @@ func (u *Uploader) createBuildPayload() error {
 	switch u.buildSuffix {
 	case "app":
 		if !isDir(u.buildPath) {
-			return fmt.Errorf("Unable to read build at ‘%s’", u.buildPath)
+			return newCategorizedError(ErrInvalidBuildPath, nil, "Unable to read build at ‘%s’", u.buildPath)
+		}
+
+		fileCount, err := zipDir(u.buildPayloadPath, parentPath, buildName)
+
+		if err != nil {
+			return err
 		}
 
-		return zipDir(u.buildPayloadPath, parentPath, buildName)
+		var byteCount int64
+
+		if fi, err := os.Stat(u.buildPayloadPath); err == nil {
+			byteCount = fi.Size()
+		}
+
+		u.logger.Log(LevelInfo, "Created build payload",
+			Field("path", u.buildPayloadPath),
+			Field("files", fileCount),
+			Field("bytes", byteCount))
+
+		return nil
+
+	case "apks":
+		if len(u.buildEntry) == 0 {
+			return nil // upload the whole set
+		}
+
+		byteCount, err := extractZipEntry(u.buildPath, u.buildEntry, u.buildPayloadPath)
+
+		if err != nil {
+			return newCategorizedError(ErrInvalidBuildPath, err, "Unable to extract ‘%s’ from build at ‘%s’, error: %v", u.buildEntry, u.buildPath, err)
+		}
+
+		u.logger.Log(LevelInfo, "Created build payload",
+			Field("path", u.buildPayloadPath),
+			Field("entry", u.buildEntry),
+			Field("bytes", byteCount))
+
+		return nil
 
 	default:
 		if !isRegular(u.buildPath) {
-			return fmt.Errorf("Unable to read build at ‘%s’", u.buildPath)
+			return newCategorizedError(ErrInvalidBuildPath, nil, "Unable to read build at ‘%s’", u.buildPath)
 		}
 
 		return nil
@@ -241,22 +327,18 @@ func (u *Uploader) createBuildPayload() error {
 }
 
 func (u *Uploader) dumpRequest(req *http.Request, body bool) {
-	if u.userVerbose {
-		dump, err := httputil.DumpRequestOut(req, body)
+	dump, err := httputil.DumpRequestOut(req, body)
 
-		if err == nil {
-			fmt.Printf("\n--- Request ---\n%s\n", dump)
-		}
+	if err == nil {
+		u.logger.Log(LevelDebug, "HTTP request", Field("dump", string(dump)))
 	}
 }
 
 func (u *Uploader) dumpResponse(resp *http.Response, body bool) {
-	if u.userVerbose {
-		dump, err := httputil.DumpResponse(resp, body)
+	dump, err := httputil.DumpResponse(resp, body)
 
-		if err == nil {
-			fmt.Printf("\n--- Response ---\n%s\n", dump)
-		}
+	if err == nil {
+		u.logger.Log(LevelDebug, "HTTP response", Field("dump", string(dump)))
 	}
 }
 
@@ -264,31 +346,110 @@ func (u *Uploader) errorContentType() string {
 	return "application/json"
 }
 
-func (u *Uploader) makeBuildURL() string {
-	buildURL := u.userOverrides["apiBuildEndpoint"]
+func (u *Uploader) flushErrorReports() {
+	if u.config.DryRun || u.config.ErrorReporting != SendErrorReports || len(u.config.ErrorSpoolPath) == 0 {
+		return
+	}
+
+	for _, path := range spooledErrorReports(u.config.ErrorSpoolPath) {
+		body, err := os.ReadFile(path)
+
+		if err == nil {
+			err = u.uploadError(string(body))
+		}
+
+		if err != nil {
+			u.logger.Log(LevelWarn, "Unable to send spooled error report", Field("error", err), Field("path", path))
+
+			return // most likely still unreachable, try again next time
+		}
+
+		os.Remove(path)
+
+		u.logger.Log(LevelInfo, "Sent spooled error report", Field("path", path))
+	}
+}
+
+func (u *Uploader) gitBranchRule() string {
+	if u.gitInfo.BranchRule() == NoBranchRule {
+		return ""
+	}
+
+	return u.gitInfo.BranchRule().String()
+}
+
+func (u *Uploader) gitDirty() string {
+	if u.gitInfo.Access() != Ok || len(u.gitInfo.Commit()) == 0 {
+		return "" // unknown
+	}
+
+	return strconv.FormatBool(u.gitInfo.IsDirty())
+}
 
-	if len(buildURL) == 0 {
-		buildURL = defaultAPIBuildEndpoint
+func (u *Uploader) gitHistory() string {
+	if u.gitInfo.History() == UnknownHistory {
+		return ""
 	}
 
+	return u.gitInfo.History().String()
+}
+
+func (u *Uploader) httpClient() *http.Client {
+	if u.client == nil {
+		u.client = &http.Client{} // not validated
+	}
+
+	return u.client
+}
+
+func (u *Uploader) makeBuildURL() string {
+	buildURL := u.config.buildEndpoint()
+
 	query := make(url.Values)
 
 	addIfNotEmpty(&query, "agentName", agentName)
 	addIfNotEmpty(&query, "agentVersion", agentVersion)
+	addIfNotEmpty(&query, "appABIs", strings.Join(u.androidMetadata.ABIs(), ","))
+	addIfNotEmpty(&query, "appDebuggable", formatBool(u.androidMetadata.IsDebuggable()))
+	addIfNotEmpty(&query, "appDisplayName", u.iosMetadata.DisplayName())
+	addIfNotEmpty(&query, "appID", u.appID())
+	addIfNotEmpty(&query, "appMinOS", u.iosMetadata.MinimumOSVersion())
+	addIfNotEmpty(&query, "appMinSDK", formatInt(u.androidMetadata.MinSDKVersion()))
+	addIfNotEmpty(&query, "appPlatforms", strings.Join(u.iosMetadata.Platforms(), ","))
+	addIfNotEmpty(&query, "appTargetSDK", formatInt(u.androidMetadata.TargetSDKVersion()))
+	addIfNotEmpty(&query, "appVersionCode", u.appVersionCode())
+	addIfNotEmpty(&query, "appVersionName", u.appVersionName())
 	addIfNotEmpty(&query, "arch", u.arch)
-	addIfNotEmpty(&query, "ci", u.ciInfo.Provider().String())
+	addIfNotEmpty(&query, "ci", u.ciInfo.ProviderName())
 	addIfNotEmpty(&query, "ciGitBranch", u.ciInfo.GitBranch())
 	addIfNotEmpty(&query, "ciGitCommit", u.ciInfo.GitCommit())
 	addIfNotEmpty(&query, "flavor", u.flavor)
 	addIfNotEmpty(&query, "gitAccess", u.gitInfo.Access().String())
+	addIfNotEmpty(&query, "gitAuthorDate", formatTime(u.gitInfo.AuthorDate()))
+	addIfNotEmpty(&query, "gitAuthorName", truncate(u.gitInfo.AuthorName(), maxGitNameLength))
 	addIfNotEmpty(&query, "gitBranch", u.gitInfo.Branch())
+	addIfNotEmpty(&query, "gitBranchRule", u.gitBranchRule())
 	addIfNotEmpty(&query, "gitCommit", u.gitInfo.Commit())
+	addIfNotEmpty(&query, "gitCommitBody", truncate(u.gitInfo.CommitBody(), maxGitCommitBodyLength))
+	addIfNotEmpty(&query, "gitCommitParents", strings.Join(u.gitInfo.Parents(), ","))
+	addIfNotEmpty(&query, "gitCommitSubject", truncate(u.gitInfo.CommitSubject(), maxGitCommitSubjectLength))
+	addIfNotEmpty(&query, "gitCommitterDate", formatTime(u.gitInfo.CommitterDate()))
+	addIfNotEmpty(&query, "gitCommitterName", truncate(u.gitInfo.CommitterName(), maxGitNameLength))
+	addIfNotEmpty(&query, "gitDescribe", u.gitInfo.Describe())
+	addIfNotEmpty(&query, "gitDetachedHead", formatBool(u.gitInfo.IsDetachedHead()))
+	addIfNotEmpty(&query, "gitDiffHash", u.gitInfo.DiffHash())
+	addIfNotEmpty(&query, "gitDirty", u.gitDirty())
+	addIfNotEmpty(&query, "gitHistory", u.gitHistory())
+	addIfNotEmpty(&query, "gitMergeCommit", formatBool(u.gitInfo.IsMergeCommit()))
+	addIfNotEmpty(&query, "gitNearestTag", u.gitInfo.NearestTag())
+	addIfNotEmpty(&query, "gitRepository", u.gitInfo.Remote().Identity())
+	addIfNotEmpty(&query, "gitTags", strings.Join(u.gitInfo.Tags(), ","))
 	addIfNotEmpty(&query, "platform", u.platform)
-	addIfNotEmpty(&query, "userGitBranch", u.userGitBranch)
-	addIfNotEmpty(&query, "userGitCommit", u.userGitCommit)
-	addIfNotEmpty(&query, "variantName", u.userVariantName)
-	addIfNotEmpty(&query, "wrapperName", u.userOverrides["wrapperName"])
-	addIfNotEmpty(&query, "wrapperVersion", u.userOverrides["wrapperVersion"])
+	addIfNotEmpty(&query, "userGitBranch", u.config.GitBranch)
+	addIfNotEmpty(&query, "userGitCommit", u.config.GitCommit)
+	addIfNotEmpty(&query, "variantName", u.config.VariantName)
+	addIfNotEmpty(&query, "wrapperName", u.config.WrapperName)
+	addIfNotEmpty(&query, "wrapperVersion", u.config.WrapperVersion)
 
 	buildURL += "?" + query.Encode()
 
@@ -296,32 +457,125 @@ func (u *Uploader) makeBuildURL() string {
 }
 
 func (u *Uploader) makeErrorPayload(err error) string {
-	payload := ""
+	payload := make(map[string]interface{})
+
+	appendIfNotEmpty(payload, "agentName", agentName)
+	appendIfNotEmpty(payload, "agentVersion", agentVersion)
+	appendIfNotEmpty(payload, "arch", u.arch)
+	appendIfNotEmpty(payload, "ci", u.ciInfo.ProviderName())
+	appendIfNotEmpty(payload, "ciGitBranch", u.ciInfo.GitBranch())
+	appendIfNotEmpty(payload, "ciGitCommit", u.ciInfo.GitCommit())
+	appendIfNotEmpty(payload, "message", u.redactor.redact(err.Error()))
+	appendIfNotEmpty(payload, "platform", u.platform)
+	appendIfNotEmpty(payload, "wrapperName", u.config.WrapperName)
+	appendIfNotEmpty(payload, "wrapperVersion", u.config.WrapperVersion)
+
+	return marshalPayload(payload)
+}
+
+func (u *Uploader) makeErrorURL() string {
+	return u.config.errorEndpoint()
+}
+
+func (u *Uploader) readBuildMetadata(buildPath, buildSuffix, flavor string) error {
+	expectations := &u.config.BuildExpectations
 
-	appendIfNotEmpty(&payload, "agentName", agentName)
-	appendIfNotEmpty(&payload, "agentVersion", agentVersion)
-	appendIfNotEmpty(&payload, "arch", u.arch)
-	appendIfNotEmpty(&payload, "ci", u.ciInfo.Provider().String())
-	appendIfNotEmpty(&payload, "ciGitBranch", u.ciInfo.GitBranch())
-	appendIfNotEmpty(&payload, "ciGitCommit", u.ciInfo.GitCommit())
-	appendIfNotEmpty(&payload, "message", err.Error())
-	appendIfNotEmpty(&payload, "platform", u.platform)
-	appendIfNotEmpty(&payload, "wrapperName", u.userOverrides["wrapperName"])
-	appendIfNotEmpty(&payload, "wrapperVersion", u.userOverrides["wrapperVersion"])
+	var err error
 
-	payload = "{" + payload + "}"
+	switch flavor {
+	case "Android":
+		u.androidMetadata, err = ReadAndroidMetadata(buildPath)
+
+	case "iOS":
+		u.iosMetadata, err = ReadIOSMetadata(buildPath)
+	}
+
+	if err != nil {
+		if expectations.isZero() {
+			u.logger.Log(LevelWarn, "Unable to read build metadata", Field("error", err))
+
+			return nil // let Waldo decide
+		}
+
+		return newCategorizedError(ErrInvalidBuildPath, err, "Unable to read build at ‘%s’, error: %v", buildPath, err)
+	}
+
+	u.logger.Log(LevelInfo, "Read build metadata",
+		Field("appID", u.appID()),
+		Field("versionCode", u.appVersionCode()),
+		Field("versionName", u.appVersionName()))
+
+	if u.androidMetadata != nil {
+		return u.androidMetadata.check(expectations)
+	}
+
+	if err = u.iosMetadata.check(expectations); err != nil {
+		return err
+	}
 
-	return payload
+	if buildSuffix == "app" || buildSuffix == "zip" || expectations.Simulator {
+		return u.checkSimulatorBuild(buildPath, expectations.Simulator)
+	}
+
+	return nil
 }
 
-func (u *Uploader) makeErrorURL() string {
-	errorURL := u.userOverrides["apiErrorEndpoint"]
+func (u *Uploader) reportError(err error) {
+	body := u.makeErrorPayload(err)
+
+	reporting := u.config.ErrorReporting
 
-	if len(errorURL) == 0 {
-		errorURL = defaultAPIErrorEndpoint
+	if u.config.DryRun && reporting == SendErrorReports {
+		reporting = PrintErrorReports
 	}
 
-	return errorURL
+	switch reporting {
+	case DisableErrorReports:
+		return
+
+	case PrintErrorReports:
+		logger := u.logger
+
+		//
+		// The report must be shown even if diagnostics are discarded:
+		//
+		if _, ok := u.config.Logger.(nopLogger); ok {
+			logger = &redactingLogger{
+				logger:   NewTextLogger(nil, LevelInfo),
+				redactor: u.redactor}
+		}
+
+		logger.Log(LevelInfo, "Error report (not sent)", Field("body", body))
+
+		return
+
+	case SpoolErrorReports:
+		u.spoolErrorReport(body)
+
+		return
+	}
+
+	if err := u.uploadError(body); err != nil {
+		u.logger.Log(LevelWarn, "Unable to report error to Waldo", Field("error", err))
+
+		if len(u.config.ErrorSpoolPath) > 0 {
+			u.spoolErrorReport(body)
+		}
+
+		return
+	}
+
+	u.logger.Log(LevelDebug, "Reported error to Waldo")
+}
+
+func (u *Uploader) spoolErrorReport(body string) {
+	path, err := writeErrorReport(u.config.errorSpoolPath(), body)
+
+	if err != nil {
+		u.logger.Log(LevelWarn, "Unable to spool error report", Field("error", err))
+	} else {
+		u.logger.Log(LevelInfo, "Spooled error report", Field("path", path))
+	}
 }
 
 func (u *Uploader) uploadBuild() error {
@@ -330,43 +584,57 @@ func (u *Uploader) uploadBuild() error {
 	file, err := os.Open(u.buildPayloadPath)
 
 	if err != nil {
-		return fmt.Errorf("Unable to upload build to Waldo, error: %v, url: %s", err, url)
+		return fmt.Errorf("Unable to upload build to Waldo, error: %w, url: %s", err, url)
 	}
 
 	defer file.Close()
 
-	client := &http.Client{}
+	client := u.httpClient()
 
 	req, err := http.NewRequest("POST", url, file)
 
 	if err != nil {
-		return fmt.Errorf("Unable to upload build to Waldo, error: %v, url: %s", err, url)
+		return fmt.Errorf("Unable to upload build to Waldo, error: %w, url: %s", err, url)
 	}
 
 	req.Header.Add("Authorization", u.authorization())
 	req.Header.Add("Content-Type", u.buildContentType())
 	req.Header.Add("User-Agent", u.userAgent())
 
+	if u.config.DryRun {
+		var size int64
+
+		if fi, err := file.Stat(); err == nil {
+			size = fi.Size()
+		}
+
+		u.dryRunRequest = logDryRunRequest(u.logger, req, "", size, u.redactor)
+
+		return nil
+	}
+
 	u.dumpRequest(req, false)
 
 	resp, err := client.Do(req)
 
 	if err != nil {
-		return fmt.Errorf("Unable to upload build to Waldo, error: %v, url: %s", err, url)
+		return &NetworkError{
+			Action: "upload build to Waldo",
+			Err:    err,
+			URL:    url}
 	}
 
 	u.dumpResponse(resp, true)
 
 	defer resp.Body.Close()
 
-	return u.checkBuildStatus(resp)
+	return checkResponseStatus(resp, "upload build to Waldo")
 }
 
-func (u *Uploader) uploadError(err error) error {
+func (u *Uploader) uploadError(body string) error {
 	url := u.makeErrorURL()
-	body := u.makeErrorPayload(err)
 
-	client := &http.Client{}
+	client := u.httpClient()
 
 	req, err := http.NewRequest("POST", url, strings.NewReader(body))
 
@@ -378,29 +646,32 @@ func (u *Uploader) uploadError(err error) error {
 	req.Header.Add("Content-Type", u.errorContentType())
 	req.Header.Add("User-Agent", u.userAgent())
 
-	// u.dumpRequest(req, true)
+	u.dumpRequest(req, true)
 
 	resp, err := client.Do(req)
 
 	if err != nil {
-		return err
+		return &NetworkError{
+			Action: "report error to Waldo",
+			Err:    err,
+			URL:    url}
 	}
 
-	defer resp.Body.Close()
+	u.dumpResponse(resp, true)
 
-	// u.dumpResponse(resp, true)
+	defer resp.Body.Close()
 
-	return nil
+	return checkResponseStatus(resp, "report error to Waldo")
 }
 
 func (u *Uploader) userAgent() string {
-	ci := u.ciInfo.Provider().String()
+	ci := u.ciInfo.ProviderName()
 
 	if ci == "Unknown" {
 		ci = "Go CLI" // hack for now…
 	}
 
-	version := u.userOverrides["wrapperVersion"]
+	version := u.config.WrapperVersion
 
 	if len(version) == 0 {
 		version = agentVersion
@@ -408,3 +679,71 @@ func (u *Uploader) userAgent() string {
 
 	return fmt.Sprintf("Waldo %s/%s v%s", ci, u.flavor, version)
 }
+
+func (u *Uploader) validate() error {
+	if u.validated {
+		return nil
+	}
+
+	err := validateUploadToken(u.config.UploadToken)
+
+	if err != nil {
+		return err
+	}
+
+	client, err := u.config.newHTTPClient()
+
+	if err != nil {
+		return err
+	}
+
+	buildPath, buildSuffix, flavor, err := validateBuildPath(u.config.BuildPath)
+
+	if err != nil {
+		// u.uploadError(err) ???
+
+		return err
+	}
+
+	buildEntry, err := checkAndroidBuildStructure(buildPath, buildSuffix)
+
+	if err != nil {
+		return err
+	}
+
+	if err = u.readBuildMetadata(buildPath, buildSuffix, flavor); err != nil {
+		return err
+	}
+
+	workingPath := determineWorkingPath()
+
+	u.arch = detectArch()
+	u.buildEntry = buildEntry
+	u.buildPath = buildPath
+	u.buildPayloadPath = determineBuildPayloadPath(workingPath, buildPath, buildSuffix, buildEntry)
+	u.buildSuffix = buildSuffix
+	u.ciInfo = DetectCIInfoWithOptions(true, InferOptions{
+		Environment: u.config.Environment,
+		Overrides:   u.config.Overrides})
+	u.client = client
+	u.flavor = flavor
+	u.gitInfo = InferGitInfoWithOptions(u.ciInfo.SkipCount(), InferOptions{
+		BranchPolicy:  u.branchPolicy(),
+		CommandRunner: u.commandRunner(),
+		DiffHash:      u.config.GitDiffHash,
+		Environment:   u.config.Environment})
+	u.platform = detectPlatform()
+	u.validated = true
+	u.workingPath = workingPath
+
+	logCIInfo(u.logger, u.ciInfo)
+
+	u.logger.Log(LevelInfo, "Inferred git info",
+		Field("access", u.gitInfo.Access().String()),
+		Field("branch", u.gitInfo.Branch()),
+		Field("branchRule", u.gitInfo.BranchRule().String()),
+		Field("commit", u.gitInfo.Commit()),
+		Field("history", u.gitInfo.History().String()))
+
+	return nil
+}
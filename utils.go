@@ -3,7 +3,7 @@ package waldo
 import (
 	"archive/zip"
 	"bytes"
-	"errors"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/fs"
@@ -12,7 +12,9 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func Version() string {
@@ -27,16 +29,16 @@ func addIfNotEmpty(query *url.Values, key string, value string) {
 	}
 }
 
-func appendIfNotEmpty(payload *string, key string, value string) {
-	if len(key) == 0 || len(value) == 0 {
-		return
+func appendIfNotEmpty(payload map[string]interface{}, key string, value string) {
+	if len(key) > 0 && len(value) > 0 {
+		payload[key] = value
 	}
+}
 
-	if len(*payload) > 0 {
-		*payload += ","
+func appendListIfNotEmpty(payload map[string]interface{}, key string, values []string) {
+	if len(key) > 0 && len(values) > 0 {
+		payload[key] = values
 	}
-
-	*payload += fmt.Sprintf(`"%s":"%s"`, key, value)
 }
 
 func detectArch() string {
@@ -63,13 +65,20 @@ func detectPlatform() string {
 	}
 }
 
-func determineBuildPayloadPath(workingPath, buildPath, buildSuffix string) string {
+func determineBuildPayloadPath(workingPath, buildPath, buildSuffix, buildEntry string) string {
 	buildName := filepath.Base(buildPath)
 
 	switch buildSuffix {
 	case "app":
 		return filepath.Join(workingPath, buildName+".zip")
 
+	case "apks":
+		if len(buildEntry) == 0 {
+			return buildPath
+		}
+
+		return filepath.Join(workingPath, strings.TrimSuffix(buildName, ".apks")+".apk")
+
 	default:
 		return buildPath
 	}
@@ -79,6 +88,30 @@ func determineWorkingPath() string {
 	return filepath.Join(os.TempDir(), fmt.Sprintf("WaldoGoLib-%d", os.Getpid()))
 }
 
+func formatBool(value bool) string {
+	if value {
+		return "true"
+	}
+
+	return ""
+}
+
+func formatInt(value int) string {
+	if value == 0 {
+		return ""
+	}
+
+	return strconv.Itoa(value)
+}
+
+func formatTime(value time.Time) string {
+	if value.IsZero() {
+		return ""
+	}
+
+	return value.Format(time.RFC3339)
+}
+
 func isDir(path string) bool {
 	fi, err := os.Stat(path)
 
@@ -99,6 +132,22 @@ func isRegular(path string) bool {
 	return fi.Mode().IsRegular()
 }
 
+// Encodes a JSON payload built with appendIfNotEmpty, escaping any quotes or
+// newlines in its values.
+func marshalPayload(payload map[string]interface{}) string {
+	var buffer bytes.Buffer
+
+	encoder := json.NewEncoder(&buffer)
+
+	encoder.SetEscapeHTML(false)
+
+	if err := encoder.Encode(payload); err != nil {
+		return "{}"
+	}
+
+	return strings.TrimSuffix(buffer.String(), "\n")
+}
+
 func run(name string, args ...string) (string, string, error) {
 	var (
 		stderrBuffer bytes.Buffer
@@ -118,56 +167,90 @@ func run(name string, args ...string) (string, string, error) {
 	return stdout, stderr, err
 }
 
+func splitList(value string) []string {
+	var items []string
+
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+func truncate(value string, maxLength int) string {
+	runes := []rune(value)
+
+	if len(runes) <= maxLength {
+		return value
+	}
+
+	return string(runes[:maxLength-1]) + "…"
+}
+
 func validateBuildPath(buildPath string) (string, string, string, error) {
 	if len(buildPath) == 0 {
-		return "", "", "", errors.New("Empty build path")
+		return "", "", "", newCategorizedError(ErrInvalidBuildPath, nil, "Empty build path")
 	}
 
 	buildPath, err := filepath.Abs(buildPath)
 
 	if err != nil {
-		return "", "", "", err
+		return "", "", "", newCategorizedError(ErrInvalidBuildPath, err, "Invalid build path: %v", err)
 	}
 
 	buildSuffix := strings.TrimPrefix(filepath.Ext(buildPath), ".")
 
 	switch buildSuffix {
-	case "apk":
+	case "aab", "apk", "apks":
 		return buildPath, buildSuffix, "Android", nil
 
 	case "app", "ipa":
 		return buildPath, buildSuffix, "iOS", nil
 
+	case "xcarchive":
+		appPath, err := findArchivedApp(buildPath)
+
+		if err != nil {
+			return "", "", "", newCategorizedError(ErrInvalidBuildPath, err, "Invalid Xcode archive at ‘%s’, error: %v", buildPath, err)
+		}
+
+		return appPath, "app", "iOS", nil
+
+	case "zip":
+		if err := checkZippedApp(buildPath); err != nil {
+			return "", "", "", newCategorizedError(ErrInvalidBuildPath, err, "Invalid zipped app at ‘%s’, error: %v", buildPath, err)
+		}
+
+		return buildPath, buildSuffix, "iOS", nil
+
 	default:
-		return "", "", "", fmt.Errorf("File extension of build at ‘%s’ is not recognized", buildPath)
+		return "", "", "", newCategorizedError(ErrUnsupportedBuildType, nil, "File extension of build at ‘%s’ is not recognized", buildPath)
 	}
 }
 
 func validateUploadToken(uploadToken string) error {
 	if len(uploadToken) == 0 {
-		return errors.New("Empty upload token")
+		return newCategorizedError(ErrInvalidUploadToken, nil, "Empty upload token")
 	}
 
 	return nil
 }
 
-func zipDir(zipPath string, dirPath string, basePath string) error {
-	err := os.Chdir(dirPath)
-
-	if err != nil {
-		return err
-	}
-
+func zipDir(zipPath string, dirPath string, basePath string) (int, error) {
 	zipFile, err := os.Create(zipPath)
 
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	defer zipFile.Close()
 
 	zipWriter := zip.NewWriter(zipFile)
 
+	fileCount := 0
+
 	walker := func(path string, entry fs.DirEntry, err error) error {
 		if err != nil {
 			return err
@@ -185,7 +268,17 @@ func zipDir(zipPath string, dirPath string, basePath string) error {
 
 		defer file.Close()
 
-		zipEntry, err := zipWriter.Create(path)
+		//
+		// Entries are named relative to `dirPath` (so that they start with
+		// `basePath`) without changing the working directory:
+		//
+		name, err := filepath.Rel(dirPath, path)
+
+		if err != nil {
+			return err
+		}
+
+		zipEntry, err := zipWriter.Create(filepath.ToSlash(name))
 
 		if err != nil {
 			return err
@@ -193,16 +286,18 @@ func zipDir(zipPath string, dirPath string, basePath string) error {
 
 		_, err = io.Copy(zipEntry, file)
 
+		fileCount++
+
 		return err
 	}
 
-	err = filepath.WalkDir(basePath, walker)
+	err = filepath.WalkDir(filepath.Join(dirPath, basePath), walker)
 
 	err2 := zipWriter.Close()
 
 	if err != nil {
-		return err
+		return fileCount, err
 	}
 
-	return err2
+	return fileCount, err2
 }
@@ -7,4 +7,8 @@ const (
 	defaultAPIBuildEndpoint   = "https://api.waldo.com/versions"
 	defaultAPIErrorEndpoint   = "https://api.waldo.com/uploadError"
 	defaultAPITriggerEndpoint = "https://api.waldo.com/suites"
+
+	maxGitCommitBodyLength    = 1000
+	maxGitCommitSubjectLength = 200
+	maxGitNameLength          = 100
 )
@@ -0,0 +1,76 @@
+package waldo_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/waldoapp/waldo-go-lib"
+	"github.com/waldoapp/waldo-go-lib/waldotest"
+)
+
+const secretUploadToken = "f00dfacef00dfacef00dfacef00dface"
+
+// Reports that the working directory is not a git repository, whatever the
+// command.
+type failingCommandRunner struct{}
+
+type recordingLogger struct {
+	entries []string
+}
+
+func (fcr failingCommandRunner) LookPath(file string) (string, error) {
+	return "/usr/bin/" + file, nil
+}
+
+func (fcr failingCommandRunner) Run(name string, args ...string) (string, string, error) {
+	return "", "fatal: not a git repository", errors.New("exit status 128")
+}
+
+func (rl *recordingLogger) Log(level waldo.LogLevel, message string, fields ...waldo.LogField) {
+	entry := level.String() + " " + message
+
+	for _, field := range fields {
+		entry += fmt.Sprintf(" %s=%v", field.Key, field.Value)
+	}
+
+	rl.entries = append(rl.entries, entry)
+}
+
+func buildFixture(t *testing.T) string {
+	buildPath := filepath.Join(t.TempDir(), "app.apk")
+
+	if err := os.WriteFile(buildPath, []byte("apk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return buildPath
+}
+
+func newServer(t *testing.T) *waldotest.Server {
+	server := waldotest.NewServer()
+
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// Directs an Uploader or a Triggerer to the server, without consulting the real
+// environment or git repository. Later options take precedence.
+func serverOptions(server *waldotest.Server, options ...waldo.Option) []waldo.Option {
+	return append(append([]waldo.Option{
+		waldo.WithCommandRunner(failingCommandRunner{}),
+		waldo.WithEnvironment(waldo.MapEnvironment{})}, server.Options()...), options...)
+}
+
+func upload(t *testing.T, server *waldotest.Server, options ...waldo.Option) error {
+	uploader := waldo.NewUploaderWithOptions(buildFixture(t), secretUploadToken, serverOptions(server, options...)...)
+
+	if err := uploader.Validate(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	return uploader.Upload()
+}
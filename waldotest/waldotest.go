@@ -0,0 +1,266 @@
+// Package waldotest provides an in-process fake of the Waldo API for testing
+// code that uses the waldo package.
+//
+// The fake records every request it receives and answers with scripted
+// responses. Plug it into an Uploader or a Triggerer through the options
+// returned by Server.Options (or the overrides returned by Server.Overrides):
+//
+//	server := waldotest.NewServer()
+//	defer server.Close()
+//
+//	uploader := waldo.NewUploaderWithOptions(buildPath, token, server.Options()...)
+package waldotest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/waldoapp/waldo-go-lib"
+)
+
+type Request struct {
+	Body     []byte
+	Endpoint waldo.Endpoint // meaningless if Unknown
+	Header   http.Header
+	Method   string
+	Path     string
+	Query    url.Values
+	Unknown  bool // true if Path is not that of a Waldo API endpoint
+}
+
+type Response struct {
+	Body      string
+	FailAfter int           // if positive, drop the connection after reading this many bytes of the request body
+	Latency   time.Duration // delay before responding
+	Status    int           // defaults to 200
+}
+
+type Server struct {
+	defaults map[waldo.Endpoint]Response
+	mutex    sync.Mutex
+	requests []*Request
+	scripted map[waldo.Endpoint][]Response
+	server   *httptest.Server
+}
+
+//-----------------------------------------------------------------------------
+
+// Returns a response with the given HTTP status whose body carries the status
+// and message the same way the Waldo API reports failures.
+func ErrorResponse(status int, message string) Response {
+	return Response{
+		Body:   fmt.Sprintf(`{"status":%d,"message":%q}`, status, message),
+		Status: status}
+}
+
+// Starts a fake Waldo API listening on a local port. By default, every
+// endpoint answers with HTTP status 200.
+func NewServer() *Server {
+	s := &Server{
+		defaults: map[waldo.Endpoint]Response{
+			waldo.BuildEndpoint:   {Body: `{"id":"appv-0123456789abcdef"}`},
+			waldo.ErrorEndpoint:   {Body: `{}`},
+			waldo.TriggerEndpoint: {Body: `{}`}},
+		scripted: make(map[waldo.Endpoint][]Response)}
+
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+
+	return s
+}
+
+//-----------------------------------------------------------------------------
+
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Queues a response for the next request to the endpoint. Queued responses are
+// used in order; once exhausted, the default response for the endpoint is used.
+func (s *Server) Enqueue(endpoint waldo.Endpoint, response Response) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.scripted[endpoint] = append(s.scripted[endpoint], response)
+}
+
+// Returns the options that direct an Uploader or a Triggerer to this server.
+func (s *Server) Options() []waldo.Option {
+	return []waldo.Option{
+		waldo.WithEndpoint(waldo.BuildEndpoint, s.server.URL+"/versions"),
+		waldo.WithEndpoint(waldo.ErrorEndpoint, s.server.URL+"/uploadError"),
+		waldo.WithEndpoint(waldo.TriggerEndpoint, s.server.URL+"/suites")}
+}
+
+// Returns the overrides that direct an Uploader or a Triggerer to this server.
+func (s *Server) Overrides() map[string]string {
+	return map[string]string{
+		"apiBuildEndpoint":   s.server.URL + "/versions",
+		"apiErrorEndpoint":   s.server.URL + "/uploadError",
+		"apiTriggerEndpoint": s.server.URL + "/suites"}
+}
+
+// Returns every request received so far, in order.
+func (s *Server) Requests() []*Request {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]*Request(nil), s.requests...)
+}
+
+// Returns the requests received so far by the endpoint, in order.
+func (s *Server) RequestsTo(endpoint waldo.Endpoint) []*Request {
+	var requests []*Request
+
+	for _, request := range s.Requests() {
+		if !request.Unknown && request.Endpoint == endpoint {
+			requests = append(requests, request)
+		}
+	}
+
+	return requests
+}
+
+// Forgets all recorded requests and queued responses.
+func (s *Server) Reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.requests = nil
+	s.scripted = make(map[waldo.Endpoint][]Response)
+}
+
+// Replaces the response used for the endpoint when nothing is queued.
+func (s *Server) SetDefault(endpoint waldo.Endpoint, response Response) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.defaults[endpoint] = response
+}
+
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+//-----------------------------------------------------------------------------
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := endpointForPath(r.URL.Path)
+
+	response := Response{Body: `{}`, Status: http.StatusNotFound}
+
+	if ok {
+		response = s.nextResponse(endpoint)
+	}
+
+	var (
+		body []byte
+		err  error
+	)
+
+	if response.FailAfter > 0 {
+		body, err = io.ReadAll(io.LimitReader(r.Body, int64(response.FailAfter)))
+	} else {
+		body, err = io.ReadAll(r.Body)
+	}
+
+	s.record(&Request{
+		Body:     body,
+		Endpoint: endpoint,
+		Header:   r.Header.Clone(),
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		Query:    r.URL.Query(),
+		Unknown:  !ok})
+
+	if err != nil {
+		return
+	}
+
+	if response.FailAfter > 0 {
+		dropConnection(w)
+
+		return
+	}
+
+	if response.Latency > 0 {
+		select {
+		case <-time.After(response.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	status := response.Status
+
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	io.WriteString(w, response.Body)
+}
+
+func (s *Server) nextResponse(endpoint waldo.Endpoint) Response {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if queue := s.scripted[endpoint]; len(queue) > 0 {
+		s.scripted[endpoint] = queue[1:]
+
+		return queue[0]
+	}
+
+	if response, found := s.defaults[endpoint]; found {
+		return response
+	}
+
+	return Response{Body: `{}`, Status: http.StatusNotFound}
+}
+
+func (s *Server) record(request *Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.requests = append(s.requests, request)
+}
+
+//-----------------------------------------------------------------------------
+
+func dropConnection(w http.ResponseWriter) {
+	if hijacker, ok := w.(http.Hijacker); ok {
+		if conn, _, err := hijacker.Hijack(); err == nil {
+			conn.Close()
+
+			return
+		}
+	}
+
+	//
+	// Otherwise (for example, over HTTP/2), let the server abort the response
+	// without logging a stack trace:
+	//
+	panic(http.ErrAbortHandler)
+}
+
+func endpointForPath(path string) (waldo.Endpoint, bool) {
+	switch path {
+	case "/suites":
+		return waldo.TriggerEndpoint, true
+
+	case "/uploadError":
+		return waldo.ErrorEndpoint, true
+
+	case "/versions":
+		return waldo.BuildEndpoint, true
+
+	default:
+		return 0, false
+	}
+}
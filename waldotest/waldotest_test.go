@@ -0,0 +1,192 @@
+package waldotest_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waldoapp/waldo-go-lib"
+	"github.com/waldoapp/waldo-go-lib/waldotest"
+)
+
+func newServer(t *testing.T) *waldotest.Server {
+	server := waldotest.NewServer()
+
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func post(t *testing.T, url, body string) (int, string, error) {
+	req, err := http.NewRequest("POST", url, strings.NewReader(body))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Add("Authorization", "Upload-Token 0123456789abcdef")
+
+	resp, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		return 0, "", err
+	}
+
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+
+	return resp.StatusCode, string(respBody), err
+}
+
+func TestServerDefaultResponses(t *testing.T) {
+	server := newServer(t)
+
+	status, body, err := post(t, server.URL()+"/versions", "apk")
+
+	if err != nil || status != http.StatusOK || !strings.Contains(body, `"id":`) {
+		t.Errorf("Expected build ID, got %d %q %v", status, body, err)
+	}
+
+	for _, path := range []string{"/suites", "/uploadError"} {
+		if status, body, err := post(t, server.URL()+path, "{}"); err != nil || status != http.StatusOK || body != "{}" {
+			t.Errorf("Expected empty object from %s, got %d %q %v", path, status, body, err)
+		}
+	}
+}
+
+func TestServerMidUploadFailure(t *testing.T) {
+	server := newServer(t)
+
+	server.Enqueue(waldo.BuildEndpoint, waldotest.Response{FailAfter: 100})
+
+	if _, _, err := post(t, server.URL()+"/versions", strings.Repeat("apk", 1000)); err == nil {
+		t.Errorf("Expected error, got nil")
+	}
+
+	if builds := server.RequestsTo(waldo.BuildEndpoint); len(builds) != 1 || len(builds[0].Body) != 100 {
+		t.Errorf("Expected 1 partial build, got %v", builds)
+	}
+}
+
+func TestServerOverrides(t *testing.T) {
+	server := newServer(t)
+
+	overrides := server.Overrides()
+
+	for key, endpoint := range map[string]waldo.Endpoint{
+		"apiBuildEndpoint":   waldo.BuildEndpoint,
+		"apiErrorEndpoint":   waldo.ErrorEndpoint,
+		"apiTriggerEndpoint": waldo.TriggerEndpoint} {
+		server.Reset()
+
+		if _, _, err := post(t, overrides[key], "{}"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if requests := server.RequestsTo(endpoint); len(requests) != 1 {
+			t.Errorf("Expected %s to reach %v, got %v", key, endpoint, server.Requests())
+		}
+	}
+}
+
+func TestServerRecordsRequest(t *testing.T) {
+	server := newServer(t)
+
+	if _, _, err := post(t, server.URL()+"/versions?variantName=release", "apk"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	builds := server.RequestsTo(waldo.BuildEndpoint)
+
+	if len(builds) != 1 {
+		t.Fatalf("Expected 1 build, got %d", len(builds))
+	}
+
+	if string(builds[0].Body) != "apk" || builds[0].Method != "POST" || builds[0].Path != "/versions" {
+		t.Errorf("Expected body, method and path, got %+v", builds[0])
+	}
+
+	if builds[0].Query.Get("variantName") != "release" {
+		t.Errorf("Expected variant, got %v", builds[0].Query)
+	}
+
+	if builds[0].Header.Get("Authorization") != "Upload-Token 0123456789abcdef" {
+		t.Errorf("Expected authorization, got %v", builds[0].Header.Get("Authorization"))
+	}
+}
+
+func TestServerScriptedResponses(t *testing.T) {
+	server := newServer(t)
+
+	server.Enqueue(waldo.BuildEndpoint, waldotest.ErrorResponse(http.StatusUnauthorized, "Unauthorized"))
+
+	status, body, err := post(t, server.URL()+"/versions", "apk")
+
+	if err != nil || status != http.StatusUnauthorized || body != `{"status":401,"message":"Unauthorized"}` {
+		t.Errorf("Expected scripted failure, got %d %q %v", status, body, err)
+	}
+
+	if status, _, _ := post(t, server.URL()+"/versions", "apk"); status != http.StatusOK {
+		t.Errorf("Expected default response once the script is exhausted, got %d", status)
+	}
+
+	server.Enqueue(waldo.BuildEndpoint, waldotest.Response{Status: http.StatusInternalServerError})
+	server.Reset()
+
+	if requests := server.Requests(); len(requests) != 0 {
+		t.Errorf("Expected no requests after reset, got %v", requests)
+	}
+
+	if status, _, _ := post(t, server.URL()+"/versions", "apk"); status != http.StatusOK {
+		t.Errorf("Expected default response after reset, got %d", status)
+	}
+}
+
+func TestServerTriggerLatency(t *testing.T) {
+	server := newServer(t)
+
+	server.SetDefault(waldo.TriggerEndpoint, waldotest.Response{Body: `{}`, Latency: 50 * time.Millisecond})
+
+	start := time.Now()
+
+	if _, _, err := post(t, server.URL()+"/suites", `{"ruleName":"smoke"}`); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected latency, got %v", elapsed)
+	}
+
+	triggers := server.RequestsTo(waldo.TriggerEndpoint)
+
+	if len(triggers) != 1 || string(triggers[0].Body) != `{"ruleName":"smoke"}` {
+		t.Errorf("Expected 1 trigger, got %v", triggers)
+	}
+}
+
+func TestServerUnknownPath(t *testing.T) {
+	server := newServer(t)
+
+	resp, err := http.Get(server.URL() + "/other")
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", resp.StatusCode)
+	}
+
+	if requests := server.Requests(); len(requests) != 1 || !requests[0].Unknown {
+		t.Errorf("Expected 1 unknown request, got %v", requests)
+	}
+
+	if builds := server.RequestsTo(waldo.BuildEndpoint); len(builds) != 0 {
+		t.Errorf("Expected no builds, got %v", builds)
+	}
+}